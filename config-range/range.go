@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+// 인자가 없을 때 쓰는 조각 크기
+var defaultChunkSize = []string{"64KiB", "256KiB", "1MiB"}
+
+// input.txt 의 파일을 받아서 조각 크기별로 조각마다 해시를 계산한다.
+// 마지막에 남는 조각은 크기가 다르므로 넣지 않는다.
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = defaultChunkSize
+	}
+
+	chunkSize := make([]int64, 0, len(args))
+	for _, arg := range args {
+		v, err := humanize.ParseBytes(arg)
+		if err != nil {
+			panic(err)
+		}
+		chunkSize = append(chunkSize, int64(v))
+	}
+
+	fi, err := os.Open("input.txt")
+	if err != nil {
+		panic(err)
+	}
+	defer fi.Close()
+	bfi := bufio.NewReader(fi)
+
+	fo, err := os.OpenFile("output.txt", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		panic(err)
+	}
+	defer fo.Close()
+	bfo := bufio.NewWriter(fo)
+
+	w := csv.NewWriter(bfo)
+
+	for {
+		line, err := bfi.ReadString('\n')
+		if err != nil && err != io.EOF {
+			panic(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		log.Println(line)
+		if line == "" {
+			break
+		}
+
+		hres, err := http.Get(line)
+		if err != nil {
+			panic(err)
+		}
+
+		var buf bytes.Buffer
+		_, err = io.Copy(&buf, hres.Body)
+		hres.Body.Close()
+		if err != nil && err != io.EOF {
+			panic(err)
+		}
+		body := buf.Bytes()
+
+		for _, size := range chunkSize {
+			for offset := int64(0); offset+size <= int64(len(body)); offset += size {
+				h := sha256.Sum256(body[offset : offset+size])
+
+				w.Write([]string{
+					line,
+					strconv.FormatInt(size, 10),
+					strconv.FormatInt(offset, 10),
+					hex.EncodeToString(h[:]),
+				})
+			}
+		}
+	}
+
+	w.Flush()
+	bfo.Flush()
+}
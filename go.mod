@@ -1,6 +1,6 @@
 module twimgdns
 
-go 1.13
+go 1.24
 
 require (
 	github.com/asmpro/go-ping v0.0.0-20200117090035-8f5c4312cd54
@@ -11,4 +11,26 @@ require (
 	github.com/json-iterator/go v1.1.9
 	github.com/miekg/dns v1.1.31
 	github.com/pkg/errors v0.9.1
+	github.com/quic-go/quic-go v0.59.0
+)
+
+require (
+	github.com/gin-contrib/sse v0.1.0 // indirect
+	github.com/go-playground/locales v0.13.0 // indirect
+	github.com/go-playground/universal-translator v0.17.0 // indirect
+	github.com/go-playground/validator/v10 v10.2.0 // indirect
+	github.com/golang/protobuf v1.3.3 // indirect
+	github.com/google/go-cmp v0.6.0 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/leodido/go-urn v1.2.0 // indirect
+	github.com/mattn/go-isatty v0.0.12 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.1 // indirect
+	github.com/quic-go/qpack v0.6.0 // indirect
+	github.com/ugorji/go/codec v1.1.7 // indirect
+	golang.org/x/crypto v0.41.0 // indirect
+	golang.org/x/net v0.43.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
+	gopkg.in/yaml.v2 v2.2.8 // indirect
 )
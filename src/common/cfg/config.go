@@ -37,39 +37,206 @@ var V struct {
 				ReadTimeout  time.Duration `json:"read_timeout"`
 				WriteTimeout time.Duration `json:"write_timeout"`
 				DialTimeout  time.Duration `json:"dial_timeout"`
-			} `json:"client"`
+			} `json:"timeout"`
 		} `json:"client"`
 
+		// ip[:port], tls://host[:port], https://host/dns-query
 		NameServerDefault []string            `json:"nameserver_default"`
 		NameServer        map[string][]string `json:"nameserver"` // NameServer[Host]=[IP]
+
+		// --server 에서 직접 응답. 켜져 있으면 zone 파일을 쓰지 않고 rndc 도 부르지 않는다
+		Server struct {
+			Enable bool     `json:"enable"`
+			Listen []string `json:"listen"` // UDP, TCP 모두
+
+			// 검사하지 않은 이름은 REFUSED, zone 이름 자체는 SOA, NS 만 응답한다.
+			// 리졸버에서는 검사하는 호스트만 이 서버로 넘겨야 한다
+			Zone string        `json:"zone"`
+			TTL  time.Duration `json:"ttl"`
+			NS   []string      `json:"ns"`
+
+			SOA struct {
+				Mbox    string        `json:"mbox"`
+				Refresh time.Duration `json:"refresh"`
+				Retry   time.Duration `json:"retry"`
+				Expire  time.Duration `json:"expire"`
+				MinTTL  time.Duration `json:"min_ttl"`
+			} `json:"soa"`
+		} `json:"server"`
+
+		// 다른 primary 에 RFC 2136 DNS UPDATE 로 바뀐 레코드만 보낸다. 켜져 있으면 zone 파일을 쓰지 않는다
+		Update struct {
+			Enable  bool          `json:"enable"`
+			Server  string        `json:"server"` // ip:port
+			Zone    string        `json:"zone"`
+			TTL     time.Duration `json:"ttl"`
+			Timeout time.Duration `json:"timeout"`
+
+			TSIG struct {
+				Name      string `json:"name"`
+				Algorithm string `json:"algorithm"` // hmac-sha256. 등
+				Secret    string `json:"secret"`    // base64
+			} `json:"tsig"`
+		} `json:"update"`
+
+		// template/zone.tmpl 로 만드는 zone 파일
+		ZoneFile struct {
+			Origin string `json:"origin"` // 검사할 때 쓸 $ORIGIN. zone.tmpl 은 RPZ 형식이라 호스트 이름이 상대 이름이므로 보통 "."
+			Keep   int    `json:"keep"`   // path.zone_history 에 남길 버전 수
+
+			// zone 파일을 바꾼 뒤 순서대로 실행. 하나가 실패하면 뒤는 실행하지 않는다
+			Hook []struct {
+				Name       string            `json:"name"`
+				Command    string            `json:"command"`
+				Args       []string          `json:"args"`
+				Env        map[string]string `json:"env"`
+				Timeout    time.Duration     `json:"timeout"` // 0 이면 제한 없음
+				Retry      int               `json:"retry"`   // 실패했을 때 다시 실행할 횟수
+				RetryDelay time.Duration     `json:"retry_delay"`
+			} `json:"hook"`
+		} `json:"zone_file"`
+
+		// 게시한 뒤 (zone 파일은 훅이 끝난 뒤) DNS 서버에 직접 물어서 게시한 A, AAAA 와 같은지 확인
+		Verify struct {
+			Enable   bool          `json:"enable"`
+			Server   []string      `json:"server"`   // ip:port
+			Zone     string        `json:"zone"`     // zone 파일을 읽어들인 zone 이름 (RPZ). 있으면 SOA serial 도 확인
+			Timeout  time.Duration `json:"timeout"`  // 질의 한번
+			Grace    time.Duration `json:"grace"`    // 이 시간 안에 맞춰지지 않으면 게시 실패
+			Interval time.Duration `json:"interval"` // 다시 물어볼 간격
+		} `json:"verify"`
 	} `json:"dns"`
 	Test struct {
 		RefreshInterval time.Duration `json:"refresh_interval"`
 
-		ThreatCrowdExpire time.Duration `json:"threatcrowd_expire"`
+		IPv6 bool `json:"ipv6"` // AAAA 레코드도 검사
+
+		Source      []CandidateSource `json:"source"`
+		CdnProvider map[string]string `json:"cdn_provider"` // CdnProvider[CNAME 도메인]=사업자
+
+		History struct {
+			Expire time.Duration `json:"expire"`
+			Top    int           `json:"top"` // 다음 검사에 다시 넣을 점수 상위 IP 수
+		} `json:"history"`
+
+		// 파일 해시가 다른 IP 처리
+		Tamper struct {
+			Quarantine time.Duration `json:"quarantine"` // 이 기간 동안 후보에서 제외. 0 이면 제외하지 않음
+			Webhook    struct {
+				URL    string            `json:"url"` // 비어있으면 보내지 않음
+				Header map[string]string `json:"header"`
+			} `json:"webhook"`
+		} `json:"tamper"`
+
+		// 후보 IP 의 이웃 주소 탐색
+		Neighbour struct {
+			Enable   bool          `json:"enable"`
+			Prefix   int           `json:"prefix"`
+			PrefixV6 int           `json:"prefix_v6"`
+			Rate     int           `json:"rate"` // 초당 시도 수. 0 이면 제한 없음
+			Timeout  time.Duration `json:"timeout"`
+		} `json:"neighbour"`
 
 		Worker struct {
 			Resolve int `json:"resolve"`
 			Ping    int `json:"ping"`
 			Http    int `json:"http"`
+			Tls     int `json:"tls"` // 0 이면 ping 과 같은 수
 		} `json:"worker"`
 
-		PingCount   int           `json:"ping_count"`
-		PingTimeout time.Duration `json:"ping_timeout"`
+		TlsTimeout time.Duration `json:"tls_timeout"`
+
+		PingMode     []string      `json:"ping_mode"` // icmp, icmp_unprivileged, tcp. 첫번째 방식으로 필터링
+		PingCount    int           `json:"ping_count"`
+		PingInterval time.Duration `json:"ping_interval"` // 0 이면 1초
+		PingTimeout  time.Duration `json:"ping_timeout"`
+
+		// 속도 검사 중에 첫번째 ping 방식으로 지연시간을 잰다
+		LoadedPing struct {
+			Enable   bool          `json:"enable"`
+			Interval time.Duration `json:"interval"`
+			Timeout  time.Duration `json:"timeout"` // 한번 보낼 때
+		} `json:"loaded_ping"`
+
+		Protocol map[string]string `json:"protocol"` // Protocol[Host] = h1, h2, h3, all. 없으면 h1
 
 		HttpTimeout      time.Duration `json:"http_timeout"`
 		HttpTestSize     uint64        `json:"http_test_size"`
 		HttpTestMaxCount int           `json:"http_test_max_count"`
 
+		// config-range.csv 의 조각을 Range 요청으로 받는 방식.
+		// 켜져 있으면 파일 목록에 있는 호스트는 http_test_size, http_test_max_count 대신 이 설정을 쓴다.
+		Range struct {
+			Enable bool `json:"enable"`
+			Count  int  `json:"count"` // 조각 크기별로 받을 조각 수
+		} `json:"range"`
+
+		Parallel int `json:"parallel"` // 후보마다 동시에 받을 연결 수. 1 이하이면 하지 않음. http_test_size, http_test_max_count 를 나눠 쓴다
+
+		// 최적 CDN 선택 기준
+		Score struct {
+			Weight     ScoreWeight            `json:"weight"`
+			HostWeight map[string]ScoreWeight `json:"host_weight"` // 호스트별로 weight 대신 쓴다
+			Threshold  struct {               // 0 이면 사용하지 않음
+				MinThroughput  uint64        `json:"min_throughput"` // bytes/s
+				MaxLatency     time.Duration `json:"max_latency"`
+				MaxJitter      time.Duration `json:"max_jitter"`
+				MaxLoss        float64       `json:"max_loss"` // 0~1
+				MaxTTFB        time.Duration `json:"max_ttfb"`
+				MaxBufferbloat time.Duration `json:"max_bufferbloat"` // 부하 중 지연시간 - 평소 지연시간
+			} `json:"threshold"`
+		} `json:"score"`
+
+		// 속도 검사 중 받은 양을 일정 간격으로 기록
+		Curve struct {
+			Enable        bool          `json:"enable"`
+			Interval      time.Duration `json:"interval"`
+			Burst         time.Duration `json:"burst"`          // 처음 이 시간 동안을 순간 속도로 본다
+			ThrottleRatio float64       `json:"throttle_ratio"` // 지속 속도 / 순간 속도 가 이보다 작으면 속도 제한으로 본다
+		} `json:"curve"`
+
 		Host map[string][]string `json:"host"` // 검사할 때 쓸 추가 호스트
 	} `json:"test"`
 	Path struct {
 		ZoneFile string `json:"zone_file"`
 		TestSave string `json:"test_save"`
 		StatLog  string `json:"stat_log"`
+		History  string `json:"history"`
+
+		ZoneHistory string `json:"zone_history"` // 이전 zone 파일을 남기는 디렉토리
 	} `json:"path"`
 }
 
+type ScoreWeight struct {
+	Throughput  float64 `json:"throughput"`
+	Latency     float64 `json:"latency"`
+	Jitter      float64 `json:"jitter"`
+	Loss        float64 `json:"loss"`
+	TTFB        float64 `json:"ttfb"`
+	Bufferbloat float64 `json:"bufferbloat"`
+	Steady      float64 `json:"steady"`
+}
+
+// 후보 IP 수집 방법
+type CandidateSource struct {
+	Type    string `json:"type"` // resolver, passive_dns, file, published, ecs
+	Name    string `json:"name"`
+	Disable bool   `json:"disable"`
+
+	URL string `json:"url"` // passive_dns, published
+
+	JsonPath   string        `json:"json_path"` // passive_dns
+	IPKey      string        `json:"ip_key"`
+	DateKey    string        `json:"date_key"`
+	DateFormat string        `json:"date_format"`
+	Expire     time.Duration `json:"expire"`
+
+	File string `json:"file"` // file
+
+	NameServer []string `json:"nameserver"` // ecs
+	Subnet     []string `json:"subnet"`
+}
+
 func init() {
 	jsoniter.RegisterTypeDecoderFunc(
 		"uint64",
@@ -0,0 +1,73 @@
+package cfg
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+const (
+	rangeFilePath = "./config-range.csv"
+)
+
+// 큰 파일의 일부분. Range 요청으로 받는다
+type RangeChunk struct {
+	URL    string
+	Size   int64
+	Offset int64
+	Hash   []byte
+}
+
+var RangeFile = make(map[string][]RangeChunk)
+
+// url,size,offset,sha256. 파일이 없으면 range 검사를 하지 않는다
+func init() {
+	fs, err := os.Open(rangeFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		panic(err)
+	}
+	defer fs.Close()
+
+	r := csv.NewReader(fs)
+	r.Comment = '#'
+
+	for {
+		r, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			panic(err)
+		}
+
+		u, err := url.Parse(r[0])
+		if err != nil {
+			panic(err)
+		}
+
+		c := RangeChunk{
+			URL: r[0],
+		}
+
+		c.Size, err = strconv.ParseInt(r[1], 10, 64)
+		if err != nil {
+			panic(err)
+		}
+		c.Offset, err = strconv.ParseInt(r[2], 10, 64)
+		if err != nil {
+			panic(err)
+		}
+		c.Hash, err = hex.DecodeString(r[3])
+		if err != nil {
+			panic(err)
+		}
+
+		RangeFile[u.Host] = append(RangeFile[u.Host], c)
+	}
+}
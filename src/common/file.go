@@ -0,0 +1,39 @@
+package common
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// 임시 파일에 쓰고 이름을 바꾼다. 중간에 실패해도 원래 파일은 그대로 남는다
+func WriteFileAtomic(path string, perm os.FileMode, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	os.MkdirAll(dir, 0700)
+
+	fs, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp := fs.Name()
+	defer os.Remove(tmp)
+
+	err = write(fs)
+	if err == nil {
+		err = fs.Sync()
+	}
+	if cerr := fs.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+
+	return errors.WithStack(err)
+}
@@ -11,9 +11,181 @@ type Result struct {
 type ResultData struct {
 	Default ResultDataCdn `json:"default"`
 	Best    ResultDataCdn `json:"best"`
+
+	DefaultV6 ResultDataCdn `json:"default_v6"`
+	BestV6    ResultDataCdn `json:"best_v6"`
+
+	Candidate    []ResultCandidate `json:"candidate,omitempty"` // /json.2 에는 포함하지 않음
+	FailureCount map[string]int    `json:"failure_count,omitempty"`
+
+	Tamper []ResultTamper `json:"tamper,omitempty"` // 격리 중인 IP
 }
 type ResultDataCdn struct {
 	Addr  string        `json:"addr"`
 	Ping  time.Duration `json:"ping"`
 	Speed float64       `json:"speed"`
+
+	CName    []string `json:"cname,omitempty"`
+	Provider string   `json:"provider,omitempty"`
+
+	CertIssuer string    `json:"cert_issuer,omitempty"`
+	CertExpire time.Time `json:"cert_expire"`
+
+	PingStat   []ResultPingStat `json:"ping_stat,omitempty"`
+	HttpStat   ResultStat       `json:"http_stat"` // bytes/s
+	HttpTiming ResultHttpTiming `json:"http_timing"`
+
+	Protocol []ResultHttpProtocol `json:"protocol,omitempty"` // 여러 프로토콜을 검사한 경우
+	Range    []ResultHttpRange    `json:"range,omitempty"`    // range 방식으로 검사한 경우
+	Parallel *ResultHttpParallel  `json:"parallel,omitempty"` // 동시 연결 검사
+
+	Bufferbloat *ResultBufferbloat `json:"bufferbloat,omitempty"`
+	Curve       *ResultCurve       `json:"curve,omitempty"`
+
+	Score ResultScore `json:"score"`
+}
+
+type ResultCandidate struct {
+	ResultDataCdn
+
+	Rank    int    `json:"rank"` // 1 부터. 0 이면 탈락
+	V6      bool   `json:"v6"`
+	Default bool   `json:"default"`
+	Source  string `json:"source"`
+	Subnet  string `json:"subnet,omitempty"`
+
+	Failure []ResultFailure `json:"failure,omitempty"`
+}
+
+const (
+	FailureDNS          = "dns"
+	FailureIcmpLoss     = "icmp_loss"
+	FailureTcpLoss      = "tcp_loss"
+	FailureTLS          = "tls"
+	FailureHttpStatus   = "http_status"
+	FailureHashMismatch = "hash_mismatch"
+	FailureTimeout      = "timeout"
+	FailureTruncated    = "truncated"
+	FailureHTTP         = "http"
+	FailureThreshold    = "threshold"
+	FailureQuarantine   = "quarantine"
+)
+
+type ResultFailure struct {
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// 검사 파일과 해시가 다른 내용을 준 IP
+type ResultTamper struct {
+	Host     string `json:"host"`
+	Addr     string `json:"addr"`
+	URL      string `json:"url"`
+	Expected string `json:"expected"` // sha256 hex
+	Actual   string `json:"actual"`
+
+	DetectedAt time.Time `json:"detected_at"`
+	Until      time.Time `json:"until"` // 격리 해제 시각
+
+	New bool `json:"new"` // 이번 검사에서 발견
+}
+
+// 항목별 점수는 0~1, 총점은 0~100
+type ResultScore struct {
+	Score float64 `json:"score"`
+
+	Throughput  float64 `json:"throughput"`
+	Latency     float64 `json:"latency"`
+	Jitter      float64 `json:"jitter"`
+	Loss        float64 `json:"loss"`
+	TTFB        float64 `json:"ttfb"`
+	Bufferbloat float64 `json:"bufferbloat"`
+	Steady      float64 `json:"steady"`
+
+	Reject string `json:"reject,omitempty"` // 넘어선 임계값
+}
+type ResultPingStat struct {
+	Mode string `json:"mode"`
+	Sent int    `json:"sent"`
+	Recv int    `json:"recv"`
+
+	Min    time.Duration `json:"min"`
+	Avg    time.Duration `json:"avg"`
+	Max    time.Duration `json:"max"`
+	StdDev time.Duration `json:"stddev"`
+
+	Stat ResultStat `json:"stat"` // ms
+}
+
+// 표본 통계. CI 는 평균의 95% 신뢰구간
+type ResultStat struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+	P95    float64 `json:"p95"`
+	StdDev float64 `json:"stddev"`
+	Jitter float64 `json:"jitter"` // 연속된 표본 차이의 평균
+	CILow  float64 `json:"ci_low"`
+	CIHigh float64 `json:"ci_high"`
+}
+
+// 요청 단계별 평균 시간
+type ResultHttpTiming struct {
+	Sample  int `json:"sample"`
+	NewConn int `json:"new_conn"`
+
+	DNS      time.Duration `json:"dns"`
+	Connect  time.Duration `json:"connect"`
+	TLS      time.Duration `json:"tls"`
+	TTFB     time.Duration `json:"ttfb"`
+	Transfer time.Duration `json:"transfer"`
+
+	Proto string `json:"proto"` // 응답의 프로토콜. 섞여 있으면 쉼표로 구분
+}
+
+type ResultHttpProtocol struct {
+	Protocol   string            `json:"protocol"` // h1, h2, h3
+	Speed      float64           `json:"speed"`
+	HttpStat   ResultStat        `json:"http_stat"`
+	HttpTiming ResultHttpTiming  `json:"http_timing"`
+	Range      []ResultHttpRange `json:"range,omitempty"`
+}
+
+// 평소와 속도 검사 중의 지연시간. 지연시간은 밀리초, 중앙값
+type ResultBufferbloat struct {
+	Mode     string         `json:"mode"`
+	Idle     float64        `json:"idle"`
+	Loaded   ResultPingStat `json:"loaded"`
+	Increase float64        `json:"increase"` // Loaded - Idle
+}
+
+// 순차 속도 검사 전체(파일 여러 개와 그 사이 요청 시간 포함) 동안 Interval 마다 기록한 누적 받은 양
+type ResultCurve struct {
+	Interval time.Duration `json:"interval"`
+	Bytes    []int64       `json:"bytes"`
+
+	Burst     float64 `json:"burst"`     // 처음 Burst 시간 동안의 속도 (bytes/s)
+	Sustained float64 `json:"sustained"` // 그 이후의 속도
+	Ratio     float64 `json:"ratio"`     // Sustained / Burst
+	Throttled bool    `json:"throttled"`
+
+	Measured bool `json:"measured"` // 검사가 Burst 보다 짧으면 false. Sustained, Ratio 는 의미 없음
+}
+
+// 같은 후보에 여러 연결(h2, h3 는 여러 스트림)로 동시에 받은 결과
+type ResultHttpParallel struct {
+	Streams int       `json:"streams"`
+	Failed  int       `json:"failed"`  // 받다가 실패한 스트림 수
+	Speed   float64   `json:"speed"`   // 받은 양 합계 / 전체 시간
+	Stream  []float64 `json:"stream"`  // 스트림별 속도. 실패하면 0
+	Scaling float64   `json:"scaling"` // 순차 검사 속도 대비. 1 보다 작으면 동시 연결에서 느려진 것
+}
+
+// 조각 크기별 속도
+type ResultHttpRange struct {
+	Size  int64      `json:"size"`
+	Speed ResultStat `json:"speed"` // bytes/s
 }
@@ -4,10 +4,9 @@ import (
 	"bufio"
 	"html/template"
 	"io"
+	"log"
 	"net/http"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"time"
 	"unsafe"
 
@@ -57,6 +56,10 @@ func init() {
 		}
 
 		setHttpJsonData(data)
+		setExplainData(data)
+		setFailureData(data)
+		setTamperData(data)
+		setDnsZone(data)
 	}
 }
 
@@ -75,71 +78,52 @@ func handleUpdateNewData(ctx *gin.Context) {
 
 	go saveResultData(data)
 	go setHttpJsonData(data)
+	go setExplainData(data)
+	go setFailureData(data)
+	go setTamperData(data)
+	go setDnsZone(data)
 }
 
 func saveResultData(data common.Result) {
-	os.MkdirAll(filepath.Dir(cfg.V.Path.TestSave), 0700)
-
-	fsSave, err := os.OpenFile(cfg.V.Path.TestSave, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 640)
+	err := common.WriteFileAtomic(cfg.V.Path.TestSave, 0640, func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		err := jsoniter.NewEncoder(bw).Encode(data)
+		if err != nil {
+			return err
+		}
+		return bw.Flush()
+	})
 	if err != nil {
 		sentry.CaptureException(err)
 		return
 	}
-	defer fsSave.Close()
-
-	fsSave.Truncate(0)
-	fsSave.Seek(0, 0)
 
-	bw := bufio.NewWriter(fsSave)
+	if cfg.V.DNS.Update.Enable {
+		publishDnsUpdateStatus(publishDnsUpdate(data))
+	}
 
-	err = jsoniter.NewEncoder(bw).Encode(data)
-	if err != nil {
-		sentry.CaptureException(err)
+	// 직접 응답하거나 DNS UPDATE 로 보내는 경우 zone 파일은 쓰지 않는다
+	if cfg.V.DNS.Server.Enable || cfg.V.DNS.Update.Enable {
 		return
 	}
-	bw.Flush()
-	fsSave.Close()
-
-	////////////////////////////////////////////////////////////////////////////////////////////////////
-	os.MkdirAll(filepath.Dir(cfg.V.Path.ZoneFile), 0700)
 
-	fsZone, err := os.OpenFile(cfg.V.Path.ZoneFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0700)
+	zone, err := renderZone(data, time.Now())
 	if err != nil {
 		sentry.CaptureException(err)
 		return
 	}
-	defer fsZone.Close()
 
-	fsSave.Truncate(0)
-	fsSave.Seek(0, 0)
+	zoneFileLock.Lock()
+	defer zoneFileLock.Unlock()
 
-	bw.Reset(fsZone)
-
-	var td struct {
-		Serial string
-		Data   common.Result
-	}
-	td.Serial = time.Now().Format("0601021504")
-	td.Data = data
-
-	err = zoneTemplate.Execute(bw, &td)
+	// 검사에 실패하면 지금 zone 파일을 그대로 둔다
+	info, err := writeZoneFile(zone)
 	if err != nil {
 		sentry.CaptureException(err)
+		log.Printf("zone : %v\n", err)
 		return
 	}
 
-	bw.Flush()
-	fsZone.Close()
-
-	////////////////////////////////////////////////////////////////////////////////////////////////////
-
-	cmd := exec.Command("rndc", "reload")
-	if cmd.Start() != nil {
-		cmd.Wait()
-	}
-
-	cmd = exec.Command("rndc", "flush", "dynamic")
-	if cmd.Start() != nil {
-		cmd.Wait()
-	}
+	info.Record = resultRecords(data)
+	publishZone(publishSourceUpdate, info)
 }
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+var (
+	statDns uint64
+
+	dnsZoneLock sync.RWMutex
+	dnsZoneData *dnsZone
+)
+
+// 검사 결과 하나로 만든 zone. 만든 뒤에는 바꾸지 않는다
+type dnsZone struct {
+	origin string
+	soa    *dns.SOA
+	ns     []dns.RR
+
+	record map[string][]dns.RR // record[이름]. A, AAAA
+}
+
+// 주소가 없는 호스트는 prev 의 레코드를 그대로 쓴다. prev 는 nil 일 수 있다
+func newDnsZone(data common.Result, prev *dnsZone, now time.Time) *dnsZone {
+	c := cfg.V.DNS.Server
+
+	z := &dnsZone{
+		origin: strings.ToLower(dns.Fqdn(c.Zone)),
+		record: make(map[string][]dns.RR, len(data.Detail)),
+	}
+
+	ttl := uint32(c.TTL / time.Second)
+	header := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+	}
+
+	// template/zone.tmpl 과 같은 형식
+	serial, _ := strconv.ParseUint(now.Format("0601021504"), 10, 32)
+
+	ns := "."
+	if len(c.NS) > 0 {
+		ns = dns.Fqdn(c.NS[0])
+	}
+	z.soa = &dns.SOA{
+		Hdr:     header(z.origin, dns.TypeSOA),
+		Ns:      ns,
+		Mbox:    dns.Fqdn(c.SOA.Mbox),
+		Serial:  uint32(serial),
+		Refresh: uint32(c.SOA.Refresh / time.Second),
+		Retry:   uint32(c.SOA.Retry / time.Second),
+		Expire:  uint32(c.SOA.Expire / time.Second),
+		Minttl:  uint32(c.SOA.MinTTL / time.Second),
+	}
+
+	for _, v := range c.NS {
+		z.ns = append(z.ns, &dns.NS{Hdr: header(z.origin, dns.TypeNS), Ns: dns.Fqdn(v)})
+	}
+
+	for host, v := range data.Detail {
+		name := strings.ToLower(dns.Fqdn(host))
+		if !dns.IsSubDomain(z.origin, name) {
+			continue
+		}
+
+		// 모든 후보가 떨어졌으면 레코드를 지우지 않는다
+		if v.Best.Addr == "" {
+			if prev != nil && prev.record[name] != nil {
+				z.record[name] = prev.record[name]
+			}
+			continue
+		}
+
+		if ip := net.ParseIP(v.Best.Addr); ip != nil && ip.To4() != nil {
+			z.record[name] = append(z.record[name], &dns.A{Hdr: header(name, dns.TypeA), A: ip.To4()})
+		}
+		if ip := net.ParseIP(v.BestV6.Addr); ip != nil && ip.To4() == nil {
+			z.record[name] = append(z.record[name], &dns.AAAA{Hdr: header(name, dns.TypeAAAA), AAAA: ip})
+		}
+	}
+
+	return z
+}
+
+func setDnsZone(data common.Result) {
+	if !cfg.V.DNS.Server.Enable {
+		return
+	}
+
+	dnsZoneLock.Lock()
+	dnsZoneData = newDnsZone(data, dnsZoneData, time.Now())
+	dnsZoneLock.Unlock()
+}
+
+func handleDns(w dns.ResponseWriter, req *dns.Msg) {
+	atomic.AddUint64(&statDns, 1)
+
+	dnsZoneLock.RLock()
+	z := dnsZoneData
+	dnsZoneLock.RUnlock()
+
+	msg := new(dns.Msg)
+	msg.SetReply(req)
+
+	if z == nil || len(req.Question) != 1 {
+		msg.Rcode = dns.RcodeServerFailure
+		w.WriteMsg(msg)
+		return
+	}
+
+	z.answer(msg, req.Question[0])
+	w.WriteMsg(msg)
+}
+
+func (z *dnsZone) answer(msg *dns.Msg, q dns.Question) {
+	name := strings.ToLower(q.Name)
+
+	if !dns.IsSubDomain(z.origin, name) {
+		msg.Rcode = dns.RcodeRefused
+		return
+	}
+	msg.Authoritative = true
+
+	var rrs []dns.RR
+	if name == z.origin {
+		rrs = append(rrs, z.soa)
+		rrs = append(rrs, z.ns...)
+	}
+	rrs = append(rrs, z.record[name]...)
+
+	// 검사하지 않은 이름은 없다고 하지 않는다. NXDOMAIN 은 리졸버에 캐시되어 실제로 있는 이름까지 막는다
+	if len(rrs) == 0 {
+		msg.Authoritative = false
+		msg.Rcode = dns.RcodeRefused
+		return
+	}
+
+	for _, rr := range rrs {
+		if q.Qtype == dns.TypeANY || q.Qtype == rr.Header().Rrtype {
+			msg.Answer = append(msg.Answer, rr)
+		}
+	}
+
+	// 이름은 있지만 해당 타입이 없음
+	if len(msg.Answer) == 0 {
+		msg.Ns = []dns.RR{z.soa}
+	} else if q.Qtype != dns.TypeNS && name != z.origin {
+		msg.Ns = z.ns
+	}
+}
+
+// 주소마다 IPv4, IPv6 를 따로 연다. [::] 를 udp 로 열면 0.0.0.0 과 겹친다
+func dnsListenNetwork(addr string) (udp, tcp string) {
+	host, _, _ := net.SplitHostPort(addr)
+	ip := net.ParseIP(host)
+
+	switch {
+	case ip == nil:
+		return "udp", "tcp"
+	case ip.To4() != nil:
+		return "udp4", "tcp4"
+	default:
+		return "udp6", "tcp6"
+	}
+}
+
+// 하나라도 열지 못하면 이미 연 것을 닫고 오류
+func startDnsServer() (shutdown func(), err error) {
+	var servers []*dns.Server
+
+	closeAll := func() {
+		for _, s := range servers {
+			if s.PacketConn != nil {
+				s.PacketConn.Close()
+			}
+			if s.Listener != nil {
+				s.Listener.Close()
+			}
+		}
+	}
+
+	for _, addr := range cfg.V.DNS.Server.Listen {
+		udp, tcp := dnsListenNetwork(addr)
+
+		pc, err := net.ListenPacket(udp, addr)
+		if err != nil {
+			closeAll()
+			return nil, errors.WithStack(err)
+		}
+		servers = append(servers, &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(handleDns)})
+
+		l, err := net.Listen(tcp, addr)
+		if err != nil {
+			closeAll()
+			return nil, errors.WithStack(err)
+		}
+		servers = append(servers, &dns.Server{Listener: l, Handler: dns.HandlerFunc(handleDns)})
+	}
+
+	for _, s := range servers {
+		go func(s *dns.Server) {
+			err := s.ActivateAndServe()
+			if err != nil {
+				sentry.CaptureException(err)
+			}
+		}(s)
+	}
+
+	return func() {
+		for _, s := range servers {
+			s.Shutdown()
+		}
+	}, nil
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+var (
+	dnsUpdateLock sync.Mutex
+	dnsUpdatePrev dnsRecordSet // primary 에 마지막으로 반영된 레코드. 시작할 때는 nil 이라 처음에는 전부 보낸다
+)
+
+type dnsRecordKey struct {
+	name   string
+	rrtype uint16
+}
+
+// dnsRecordSet[이름, 타입] = 주소
+type dnsRecordSet map[dnsRecordKey]string
+
+// 주소가 없는 호스트는 prev 의 레코드를 그대로 쓴다. 빠뜨리면 primary 에서 지워진다
+func newDnsRecordSet(data common.Result, zone string, prev dnsRecordSet) dnsRecordSet {
+	zone = strings.ToLower(dns.Fqdn(zone))
+	rs := make(dnsRecordSet, len(data.Detail)*2)
+
+	for host, v := range data.Detail {
+		name := strings.ToLower(dns.Fqdn(host))
+		if !dns.IsSubDomain(zone, name) {
+			continue
+		}
+
+		if v.Best.Addr == "" {
+			for _, rrtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+				k := dnsRecordKey{name, rrtype}
+				if addr, ok := prev[k]; ok {
+					rs[k] = addr
+				}
+			}
+			continue
+		}
+
+		if ip := net.ParseIP(v.Best.Addr); ip != nil && ip.To4() != nil {
+			rs[dnsRecordKey{name, dns.TypeA}] = ip.String()
+		}
+		if ip := net.ParseIP(v.BestV6.Addr); ip != nil && ip.To4() == nil {
+			rs[dnsRecordKey{name, dns.TypeAAAA}] = ip.String()
+		}
+	}
+
+	return rs
+}
+
+// 실패하면 이전 기록을 그대로 두고 다음 결과에서 다시 보낸다.
+// 성공하면 primary 에 있어야 할 레코드를 돌려준다
+func publishDnsUpdate(data common.Result) (dnsRecordSet, error) {
+	dnsUpdateLock.Lock()
+	defer dnsUpdateLock.Unlock()
+
+	c := cfg.V.DNS.Update
+	next := newDnsRecordSet(data, c.Zone, dnsUpdatePrev)
+
+	msg, changed := newDnsUpdate(dnsUpdatePrev, next)
+	if changed == 0 {
+		return next, nil
+	}
+
+	err := sendDnsUpdate(msg)
+	if err != nil {
+		sentry.CaptureException(err)
+		log.Printf("dns update : %v\n", err)
+		return nil, err
+	}
+
+	log.Printf("dns update : %d changed\n", changed)
+	dnsUpdatePrev = next
+	return next, nil
+}
+
+// 바뀐 레코드는 RRset 을 지우고 새로 넣는다
+func newDnsUpdate(prev, next dnsRecordSet) (*dns.Msg, int) {
+	c := cfg.V.DNS.Update
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(dns.Fqdn(c.Zone))
+
+	// 보내는 순서를 일정하게
+	keys := make([]dnsRecordKey, 0, len(prev)+len(next))
+	for k := range next {
+		keys = append(keys, k)
+	}
+	for k := range prev {
+		if _, ok := next[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, k int) bool {
+		if keys[i].name != keys[k].name {
+			return keys[i].name < keys[k].name
+		}
+		return keys[i].rrtype < keys[k].rrtype
+	})
+
+	var remove, insert []dns.RR
+	for _, k := range keys {
+		addr, ok := next[k]
+		if old, exists := prev[k]; exists && ok && old == addr {
+			continue
+		}
+
+		remove = append(remove, &dns.ANY{Hdr: dns.RR_Header{Name: k.name, Rrtype: k.rrtype, Class: dns.ClassINET}})
+		if !ok {
+			continue
+		}
+
+		hdr := dns.RR_Header{Name: k.name, Rrtype: k.rrtype, Class: dns.ClassINET, Ttl: uint32(c.TTL / time.Second)}
+		if k.rrtype == dns.TypeA {
+			insert = append(insert, &dns.A{Hdr: hdr, A: net.ParseIP(addr).To4()})
+		} else {
+			insert = append(insert, &dns.AAAA{Hdr: hdr, AAAA: net.ParseIP(addr)})
+		}
+	}
+
+	msg.RemoveRRset(remove)
+	msg.Insert(insert)
+
+	return msg, len(remove)
+}
+
+func sendDnsUpdate(msg *dns.Msg) error {
+	c := cfg.V.DNS.Update
+
+	client := dns.Client{
+		Net:     "tcp",
+		Timeout: c.Timeout,
+	}
+
+	if c.TSIG.Name != "" {
+		name := dns.Fqdn(c.TSIG.Name)
+		algorithm := dns.Fqdn(c.TSIG.Algorithm)
+		if algorithm == "." {
+			algorithm = dns.HmacSHA256
+		}
+
+		client.TsigSecret = map[string]string{name: c.TSIG.Secret}
+		msg.SetTsig(name, algorithm, 300, time.Now().Unix())
+	}
+
+	res, _, err := client.Exchange(msg, c.Server)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if res.Rcode != dns.RcodeSuccess {
+		return errors.Errorf("rcode %s", dns.RcodeToString[res.Rcode])
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testUpdateZone    = "twimg.com."
+	testUpdateKey     = "twimgdns."
+	testUpdateSecret  = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+	testUpdateTimeout = 3 * time.Second
+)
+
+// DNS UPDATE 를 받아서 기록만 하는 primary
+type testPrimary struct {
+	lock   sync.Mutex
+	rcode  int
+	update []*dns.Msg
+}
+
+func (p *testPrimary) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	msg := new(dns.Msg)
+	msg.SetReply(req)
+
+	p.lock.Lock()
+	if req.IsTsig() == nil || w.TsigStatus() != nil {
+		msg.Rcode = dns.RcodeNotAuth
+	} else {
+		msg.Rcode = p.rcode
+		p.update = append(p.update, req)
+	}
+	p.lock.Unlock()
+
+	if req.IsTsig() != nil {
+		msg.SetTsig(testUpdateKey, dns.HmacSHA256, 300, time.Now().Unix())
+	}
+	w.WriteMsg(msg)
+}
+
+// 마지막으로 받은 UPDATE 의 지운 RRset 과 넣은 레코드
+func (p *testPrimary) last(t *testing.T) (remove, insert []string) {
+	t.Helper()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.update) == 0 {
+		t.Fatal("no update received")
+	}
+	for _, rr := range p.update[len(p.update)-1].Ns {
+		h := rr.Header()
+		if h.Class == dns.ClassANY {
+			remove = append(remove, h.Name+" "+dns.TypeToString[h.Rrtype])
+		} else {
+			insert = append(insert, h.Name+" "+dns.TypeToString[h.Rrtype]+" "+verifyValue(rr))
+		}
+	}
+	sort.Strings(remove)
+	sort.Strings(insert)
+
+	return remove, insert
+}
+
+func (p *testPrimary) count() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.update)
+}
+
+func startTestPrimary(t *testing.T) *testPrimary {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testPrimary{rcode: dns.RcodeSuccess}
+	started := make(chan struct{})
+
+	server := &dns.Server{
+		Listener:          l,
+		Handler:           p,
+		TsigSecret:        map[string]string{testUpdateKey: testUpdateSecret},
+		NotifyStartedFunc: func() { close(started) },
+		// 기본값은 UPDATE 를 받지 않는다
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	c := &cfg.V.DNS.Update
+	c.Enable = true
+	c.Server = l.Addr().String()
+	c.Zone = testUpdateZone
+	c.TTL = 15 * time.Minute
+	c.Timeout = testUpdateTimeout
+	c.TSIG.Name = testUpdateKey
+	c.TSIG.Algorithm = ""
+	c.TSIG.Secret = testUpdateSecret
+
+	dnsUpdatePrev = nil
+
+	return p
+}
+
+func testResult(addr map[string][2]string) common.Result {
+	data := common.Result{
+		Detail: make(map[string]common.ResultData, len(addr)),
+	}
+	for host, v := range addr {
+		var d common.ResultData
+		d.Best.Addr = v[0]
+		d.BestV6.Addr = v[1]
+		data.Detail[host] = d
+	}
+	return data
+}
+
+func checkList(t *testing.T, what string, actual, expected []string) {
+	t.Helper()
+
+	if strings.Join(actual, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("%s : expected [%s], actual [%s]", what, strings.Join(expected, ", "), strings.Join(actual, ", "))
+	}
+}
+
+func TestDnsUpdate(t *testing.T) {
+	p := startTestPrimary(t)
+
+	// 처음에는 전부
+	_, err := publishDnsUpdate(testResult(map[string][2]string{
+		"pbs.twimg.com":   {"192.0.2.1", "2001:db8::1"},
+		"video.twimg.com": {"192.0.2.2", ""},
+		"example.com":     {"192.0.2.3", ""}, // zone 밖
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remove, insert := p.last(t)
+	checkList(t, "first remove", remove, []string{
+		"pbs.twimg.com. A",
+		"pbs.twimg.com. AAAA",
+		"video.twimg.com. A",
+	})
+	checkList(t, "first insert", insert, []string{
+		"pbs.twimg.com. A 192.0.2.1",
+		"pbs.twimg.com. AAAA 2001:db8::1",
+		"video.twimg.com. A 192.0.2.2",
+	})
+
+	// 바뀐 RRset 만
+	_, err = publishDnsUpdate(testResult(map[string][2]string{
+		"pbs.twimg.com":   {"192.0.2.1", "2001:db8::2"},
+		"video.twimg.com": {"192.0.2.2", ""},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remove, insert = p.last(t)
+	checkList(t, "second remove", remove, []string{"pbs.twimg.com. AAAA"})
+	checkList(t, "second insert", insert, []string{"pbs.twimg.com. AAAA 2001:db8::2"})
+
+	// 바뀐 것이 없으면 보내지 않는다
+	n := p.count()
+	_, err = publishDnsUpdate(testResult(map[string][2]string{
+		"pbs.twimg.com":   {"192.0.2.1", "2001:db8::2"},
+		"video.twimg.com": {"192.0.2.2", ""},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.count() != n {
+		t.Errorf("update sent without change")
+	}
+}
+
+func TestDnsUpdateKeepMissingBest(t *testing.T) {
+	p := startTestPrimary(t)
+
+	_, err := publishDnsUpdate(testResult(map[string][2]string{
+		"pbs.twimg.com":   {"192.0.2.1", "2001:db8::1"},
+		"video.twimg.com": {"192.0.2.2", ""},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// pbs 는 검사에 실패해서 주소가 없다. 이전 레코드를 지우지 않는다
+	rs, err := publishDnsUpdate(testResult(map[string][2]string{
+		"pbs.twimg.com":   {"", ""},
+		"video.twimg.com": {"192.0.2.3", ""},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remove, insert := p.last(t)
+	checkList(t, "remove", remove, []string{"video.twimg.com. A"})
+	checkList(t, "insert", insert, []string{"video.twimg.com. A 192.0.2.3"})
+
+	if rs[dnsRecordKey{"pbs.twimg.com.", dns.TypeA}] != "192.0.2.1" ||
+		rs[dnsRecordKey{"pbs.twimg.com.", dns.TypeAAAA}] != "2001:db8::1" {
+		t.Errorf("previous records not kept : %v", rs)
+	}
+}
+
+func TestDnsUpdateFailure(t *testing.T) {
+	p := startTestPrimary(t)
+
+	first := testResult(map[string][2]string{
+		"pbs.twimg.com": {"192.0.2.1", ""},
+	})
+	second := testResult(map[string][2]string{
+		"pbs.twimg.com": {"192.0.2.2", ""},
+	})
+
+	_, err := publishDnsUpdate(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.lock.Lock()
+	p.rcode = dns.RcodeRefused
+	p.lock.Unlock()
+
+	rs, err := publishDnsUpdate(second)
+	if err == nil {
+		t.Fatal("expected error on REFUSED")
+	}
+	if rs != nil {
+		t.Errorf("record set returned on failure : %v", rs)
+	}
+	if addr := dnsUpdatePrev[dnsRecordKey{"pbs.twimg.com.", dns.TypeA}]; addr != "192.0.2.1" {
+		t.Errorf("dnsUpdatePrev changed on failure : %s", addr)
+	}
+
+	// 다음 결과에서 다시 보낸다
+	p.lock.Lock()
+	p.rcode = dns.RcodeSuccess
+	p.lock.Unlock()
+
+	_, err = publishDnsUpdate(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remove, insert := p.last(t)
+	checkList(t, "retry remove", remove, []string{"pbs.twimg.com. A"})
+	checkList(t, "retry insert", insert, []string{"pbs.twimg.com. A 192.0.2.2"})
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"twimgdns/src/common"
+
+	"github.com/gin-gonic/gin"
+	jsoniter "github.com/json-iterator/go"
+)
+
+var (
+	statExplain uint64
+
+	explainLock sync.RWMutex
+	explainData = make(map[string]*responseCache)
+)
+
+type explain struct {
+	Host      string    `json:"host"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	IPv4 explainFamily  `json:"ipv4"`
+	IPv6 *explainFamily `json:"ipv6,omitempty"`
+}
+
+type explainFamily struct {
+	Best    string `json:"best"`
+	Default string `json:"default"`
+
+	MarginRunnerUp *explainMargin `json:"margin_runner_up,omitempty"`
+	MarginDefault  *explainMargin `json:"margin_default,omitempty"`
+
+	Ranking    []common.ResultCandidate `json:"ranking"`
+	Eliminated []explainEliminated      `json:"eliminated"`
+}
+
+// 1위 값 - 비교 대상 값
+type explainMargin struct {
+	Addr       string        `json:"addr"`
+	Score      float64       `json:"score"`
+	Throughput float64       `json:"throughput"` // bytes/s (중앙값)
+	Latency    time.Duration `json:"latency"`
+}
+
+type explainEliminated struct {
+	Addr   string                 `json:"addr"`
+	Source string                 `json:"source"`
+	Reason []common.ResultFailure `json:"reason"`
+}
+
+func handleExplain(ctx *gin.Context) {
+	explainLock.RLock()
+	rc, ok := explainData[strings.ToLower(ctx.Param("host"))]
+	explainLock.RUnlock()
+
+	if !ok {
+		atomic.AddUint64(&statExplain, 1)
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	rc.Handler(ctx)
+}
+
+func setExplainData(data common.Result) {
+	m := make(map[string]*responseCache, len(data.Detail))
+
+	for host, v := range data.Detail {
+		if len(v.Candidate) == 0 {
+			continue
+		}
+
+		e := explain{
+			Host:      host,
+			UpdatedAt: data.UpdatedAt,
+			IPv4:      newExplainFamily(v.Candidate, false, v.Best, v.Default),
+		}
+		if v.BestV6.Addr != "" {
+			f := newExplainFamily(v.Candidate, true, v.BestV6, v.DefaultV6)
+			e.IPv6 = &f
+		}
+
+		rc := &responseCache{
+			dataBuff: bytes.NewBuffer(nil),
+			stat:     &statExplain,
+		}
+		rc.update(
+			func(w io.Writer) error {
+				return jsoniter.NewEncoder(w).Encode(&e)
+			},
+		)
+
+		m[strings.ToLower(host)] = rc
+	}
+
+	explainLock.Lock()
+	explainData = m
+	explainLock.Unlock()
+}
+
+func newExplainFamily(candidate []common.ResultCandidate, v6 bool, best, def common.ResultDataCdn) (f explainFamily) {
+	f.Best = best.Addr
+	f.Default = def.Addr
+	f.Ranking = []common.ResultCandidate{}
+	f.Eliminated = []explainEliminated{}
+
+	for _, c := range candidate {
+		if c.V6 != v6 {
+			continue
+		}
+
+		if c.Rank > 0 {
+			f.Ranking = append(f.Ranking, c)
+		} else {
+			f.Eliminated = append(f.Eliminated, explainEliminated{c.Addr, c.Source, c.Failure})
+		}
+	}
+
+	margin := func(other common.ResultDataCdn) *explainMargin {
+		return &explainMargin{
+			Addr:       other.Addr,
+			Score:      best.Score.Score - other.Score.Score,
+			Throughput: best.HttpStat.Median - other.HttpStat.Median,
+			Latency:    best.Ping - other.Ping,
+		}
+	}
+
+	if len(f.Ranking) > 1 {
+		f.MarginRunnerUp = margin(f.Ranking[1].ResultDataCdn)
+	}
+	if def.Addr != "" && def.Addr != best.Addr {
+		f.MarginDefault = margin(def)
+	}
+
+	return
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"twimgdns/src/common"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var (
+	statFailure uint64
+
+	httpFailure = responseCache{
+		dataBuff: bytes.NewBuffer(nil),
+		stat:     &statFailure,
+	}
+)
+
+type failureReport struct {
+	UpdatedAt time.Time                    `json:"updated_at"`
+	Host      map[string]failureReportHost `json:"host"`
+}
+
+type failureReportHost struct {
+	Count     map[string]int           `json:"count"`
+	Candidate []failureReportCandidate `json:"candidate"`
+}
+
+type failureReportCandidate struct {
+	Addr       string                 `json:"addr"`
+	Source     string                 `json:"source"`
+	Eliminated bool                   `json:"eliminated"`
+	Failure    []common.ResultFailure `json:"failure"`
+}
+
+// 실패 기록이 있는 후보만 모은다
+func setFailureData(data common.Result) {
+	r := failureReport{
+		UpdatedAt: data.UpdatedAt,
+		Host:      make(map[string]failureReportHost, len(data.Detail)),
+	}
+
+	for host, v := range data.Detail {
+		h := failureReportHost{
+			Count:     v.FailureCount,
+			Candidate: []failureReportCandidate{},
+		}
+		if h.Count == nil {
+			h.Count = map[string]int{}
+		}
+
+		for _, c := range v.Candidate {
+			if len(c.Failure) == 0 {
+				continue
+			}
+			h.Candidate = append(
+				h.Candidate,
+				failureReportCandidate{
+					Addr:       c.Addr,
+					Source:     c.Source,
+					Eliminated: c.Rank == 0,
+					Failure:    c.Failure,
+				},
+			)
+		}
+
+		r.Host[host] = h
+	}
+
+	httpFailure.update(
+		func(w io.Writer) error {
+			return jsoniter.NewEncoder(w).Encode(&r)
+		},
+	)
+}
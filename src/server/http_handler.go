@@ -114,9 +114,21 @@ func setHttpJsonData(data common.Result) {
 
 	////////////////////////////////////////////////////////////////////////////////////////////////////
 
+	// 후보 목록, 실패 기록, 격리 IP 는 /explain, /failure, /tamper 에서만
+	v2 := common.Result{
+		UpdatedAt: data.UpdatedAt,
+		Detail:    make(map[string]common.ResultData, len(data.Detail)),
+	}
+	for host, v := range data.Detail {
+		v.Candidate = nil
+		v.FailureCount = nil
+		v.Tamper = nil
+		v2.Detail[host] = v
+	}
+
 	httpJson2.update(
 		func(w io.Writer) error {
-			return jsoniter.NewEncoder(w).Encode(&data)
+			return jsoniter.NewEncoder(w).Encode(&v2)
 		},
 	)
 }
@@ -30,8 +30,14 @@ func Main() {
 
 	router.GET("/json", httpJson.Handler)
 	router.GET("/json.2", httpJson2.Handler)
+	router.GET("/explain/:host", handleExplain)
+	router.GET("/failure", httpFailure.Handler)
+	router.GET("/tamper", httpTamper.Handler)
+	router.GET("/publish", handlePublish)
 
 	router.POST(common.UpdatePath, handleUpdateNewData)
+	router.GET("/zone/history", handleZoneHistory)
+	router.POST("/zone/rollback/:version", handleZoneRollback)
 
 	router.Static("/static/", "public/static/")
 	router.GET("/", func(ctx *gin.Context) {
@@ -49,6 +55,14 @@ func Main() {
 	}
 	defer listener.Close()
 
+	if cfg.V.DNS.Server.Enable {
+		shutdown, err := startDnsServer()
+		if err != nil {
+			panic(err)
+		}
+		defer shutdown()
+	}
+
 	go func() {
 		err = server.Serve(listener)
 		if err != nil && err != http.ErrServerClosed {
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+)
+
+const (
+	publishSourceUpdate    = "update"     // 새 검사 결과
+	publishSourceRollback  = "rollback"   // /zone/rollback
+	publishSourceDnsUpdate = "dns_update" // dns.update
+
+	// 훅 출력은 뒷부분만 남긴다
+	hookOutputLimit = 4096
+
+	// 시간 초과로 훅을 죽인 뒤 출력을 쥐고 있는 자식 프로세스를 기다리는 시간
+	hookWaitDelay = 5 * time.Second
+)
+
+var (
+	statPublish uint64
+
+	publishLock sync.RWMutex
+	publishLast *publishStatus
+)
+
+// 마지막으로 zone 파일을 바꾸고 DNS 데몬에 알린 결과. ok 는 훅과 확인이 모두 성공했을 때
+type publishStatus struct {
+	PublishedAt time.Time    `json:"published_at"`
+	Source      string       `json:"source"`
+	Version     string       `json:"version"`
+	Serial      uint32       `json:"serial"`
+	OK          bool         `json:"ok"`
+	Error       string       `json:"error,omitempty"` // DNS UPDATE 가 실패한 경우
+	Hook        []hookResult `json:"hook"`
+
+	Verify *publishVerify `json:"verify"` // 게시에 실패했거나 dns.verify 가 꺼져 있으면 null
+}
+
+type hookResult struct {
+	Name     string        `json:"name"`
+	Command  string        `json:"command"`
+	Attempt  int           `json:"attempt"`
+	ExitCode int           `json:"exit_code"` // 실행하지 못했거나 시간 초과면 -1
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+	OK       bool          `json:"ok"`
+}
+
+func publishZone(source string, info zoneInfo) publishStatus {
+	s := publishStatus{
+		PublishedAt: time.Now(),
+		Source:      source,
+		Version:     info.Version,
+		Serial:      info.Serial,
+		OK:          true,
+		Hook:        []hookResult{},
+	}
+
+	env := hookEnv(info)
+	for _, h := range cfg.V.DNS.ZoneFile.Hook {
+		r := runHook(h.Name, h.Command, h.Args, append(env, hookEnvConfig(h.Env)...), h.Timeout, h.Retry, h.RetryDelay)
+		s.Hook = append(s.Hook, r)
+
+		if !r.OK {
+			s.OK = false
+			log.Printf("hook %s : exit %d : %s\n", r.Name, r.ExitCode, r.Error)
+			sentry.CaptureMessage(fmt.Sprintf("hook %s : exit %d : %s", r.Name, r.ExitCode, r.Error))
+			break
+		}
+	}
+
+	if s.OK && cfg.V.DNS.Verify.Enable {
+		s.Verify = verifyPublish(verifyExpected(info))
+		s.OK = s.Verify.OK
+	}
+
+	setPublishStatus(s)
+	return s
+}
+
+// DNS UPDATE 는 훅이 없고, 보낸 레코드가 primary 에서 보이는지만 확인한다
+func publishDnsUpdateStatus(rs dnsRecordSet, err error) {
+	s := publishStatus{
+		PublishedAt: time.Now(),
+		Source:      publishSourceDnsUpdate,
+		OK:          err == nil,
+		Hook:        []hookResult{},
+	}
+
+	if err != nil {
+		s.Error = err.Error()
+	} else if cfg.V.DNS.Verify.Enable {
+		s.Verify = verifyPublish(verifyExpectedSet(rs))
+		s.OK = s.Verify.OK
+	}
+
+	setPublishStatus(s)
+}
+
+// 훅의 출력이 들어 있어서 /zone 과 같이 인증하고, 중간 캐시에 남지 않게 responseCache 를 쓰지 않는다
+func handlePublish(ctx *gin.Context) {
+	atomic.AddUint64(&statPublish, 1)
+
+	if !checkAuth(ctx) {
+		return
+	}
+
+	publishLock.RLock()
+	s := publishLast
+	publishLock.RUnlock()
+
+	ctx.Header("Cache-Control", "no-store")
+	if s == nil {
+		ctx.Status(http.StatusNoContent)
+		return
+	}
+
+	writeJson(ctx, http.StatusOK, s)
+}
+
+func setPublishStatus(s publishStatus) {
+	publishLock.Lock()
+	publishLast = &s
+	publishLock.Unlock()
+}
+
+// TWIMGDNS_RECORDS 는 "이름 타입 주소" 를 한 줄에 하나씩
+func hookEnv(info zoneInfo) []string {
+	var sb strings.Builder
+	for _, rr := range info.Record {
+		var addr string
+		switch rr := rr.(type) {
+		case *dns.A:
+			addr = rr.A.String()
+		case *dns.AAAA:
+			addr = rr.AAAA.String()
+		}
+		fmt.Fprintf(&sb, "%s %s %s\n", rr.Header().Name, dns.TypeToString[rr.Header().Rrtype], addr)
+	}
+
+	env := os.Environ()
+	return append(
+		env,
+		"TWIMGDNS_ZONE_FILE="+cfg.V.Path.ZoneFile,
+		"TWIMGDNS_VERSION="+info.Version,
+		"TWIMGDNS_SERIAL="+strconv.FormatUint(uint64(info.Serial), 10),
+		"TWIMGDNS_RECORDS="+sb.String(),
+	)
+}
+
+func hookEnvConfig(m map[string]string) []string {
+	env := make([]string, 0, len(m))
+	for k, v := range m {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+func runHook(name, command string, args, env []string, timeout time.Duration, retry int, retryDelay time.Duration) (r hookResult) {
+	r.Name = name
+	r.Command = strings.Join(append([]string{command}, args...), " ")
+
+	for r.Attempt = 1; ; r.Attempt++ {
+		runHookOnce(&r, command, args, env, timeout)
+		if r.OK || r.Attempt > retry {
+			return
+		}
+
+		common.Verbose.Printf("hook %s : attempt %d failed : %s\n", name, r.Attempt, r.Error)
+		time.Sleep(retryDelay)
+	}
+}
+
+func runHookOnce(r *hookResult, command string, args, env []string, timeout time.Duration) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// CommandContext 는 직접 실행한 프로세스만 죽인다.
+	// 손자 프로세스가 stdout, stderr 를 잡고 있으면 Run 이 zoneFileLock 을 쥔 채로 끝나지 않는다
+	cmd.WaitDelay = hookWaitDelay
+
+	start := time.Now()
+	err := cmd.Run()
+	r.Duration = time.Since(start)
+	if err == exec.ErrWaitDelay {
+		// 훅은 성공했고 남은 자식이 출력을 닫지 않았을 뿐
+		err = nil
+	}
+
+	r.Stdout = hookOutput(stdout.Bytes())
+	r.Stderr = hookOutput(stderr.Bytes())
+	r.ExitCode = -1
+	if cmd.ProcessState != nil {
+		r.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	r.Error = ""
+	if ctx.Err() == context.DeadlineExceeded {
+		r.Error = "timeout"
+	} else if err != nil {
+		r.Error = err.Error()
+	}
+
+	r.OK = err == nil && r.ExitCode == 0
+}
+
+func hookOutput(b []byte) string {
+	if len(b) > hookOutputLimit {
+		b = b[len(b)-hookOutputLimit:]
+	}
+	return string(b)
+}
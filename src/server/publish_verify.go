@@ -0,0 +1,187 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+type publishVerify struct {
+	OK       bool             `json:"ok"`
+	Attempt  int              `json:"attempt"`
+	Duration time.Duration    `json:"duration"`
+	Mismatch []verifyMismatch `json:"mismatch"` // 마지막 시도에서 맞지 않은 것
+}
+
+type verifyMismatch struct {
+	Server   string   `json:"server"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Expected []string `json:"expected"` // SOA 는 serial
+	Actual   []string `json:"actual"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type verifyQuery struct {
+	server string
+	key    dnsRecordKey
+}
+
+// verifyExpected[이름, 타입] = 정렬한 주소.
+// info.Record 는 검사 결과로 만든 것이고, SOA 는 dns.verify.zone 이 있을 때만 확인한다
+func verifyExpected(info zoneInfo) map[dnsRecordKey][]string {
+	m := make(map[dnsRecordKey][]string, len(info.Record)+1)
+	if zone := cfg.V.DNS.Verify.Zone; zone != "" && info.Serial != 0 {
+		m[dnsRecordKey{strings.ToLower(dns.Fqdn(zone)), dns.TypeSOA}] = []string{strconv.FormatUint(uint64(info.Serial), 10)}
+	}
+
+	for _, rr := range info.Record {
+		k := dnsRecordKey{strings.ToLower(rr.Header().Name), rr.Header().Rrtype}
+		m[k] = append(m[k], verifyValue(rr))
+	}
+	for _, v := range m {
+		sort.Strings(v)
+	}
+
+	return m
+}
+
+// DNS UPDATE 로 보낸 레코드. serial 은 primary 가 정한다
+func verifyExpectedSet(rs dnsRecordSet) map[dnsRecordKey][]string {
+	m := make(map[dnsRecordKey][]string, len(rs))
+	for k, addr := range rs {
+		m[k] = []string{addr}
+	}
+	return m
+}
+
+func verifyValue(rr dns.RR) string {
+	switch rr := rr.(type) {
+	case *dns.SOA:
+		return strconv.FormatUint(uint64(rr.Serial), 10)
+	case *dns.A:
+		return rr.A.String()
+	case *dns.AAAA:
+		return rr.AAAA.String()
+	}
+	return ""
+}
+
+// DNS 서버가 새 레코드를 읽을 때까지 grace 동안 다시 물어본다
+func verifyPublish(expected map[dnsRecordKey][]string) *publishVerify {
+	c := cfg.V.DNS.Verify
+
+	var pending []verifyQuery
+	for _, server := range c.Server {
+		for k := range expected {
+			pending = append(pending, verifyQuery{server, k})
+		}
+	}
+	sort.Slice(pending, func(i, k int) bool {
+		if pending[i].server != pending[k].server {
+			return pending[i].server < pending[k].server
+		}
+		if pending[i].key.name != pending[k].key.name {
+			return pending[i].key.name < pending[k].key.name
+		}
+		return pending[i].key.rrtype < pending[k].key.rrtype
+	})
+
+	v := &publishVerify{
+		Mismatch: []verifyMismatch{},
+	}
+
+	start := time.Now()
+	deadline := start.Add(c.Grace)
+
+	for v.Attempt = 1; ; v.Attempt++ {
+		var next []verifyQuery
+		v.Mismatch = v.Mismatch[:0]
+
+		for _, q := range pending {
+			actual, err := queryRecord(q.server, q.key)
+			if err == nil && strings.Join(actual, " ") == strings.Join(expected[q.key], " ") {
+				continue
+			}
+
+			m := verifyMismatch{
+				Server:   q.server,
+				Name:     q.key.name,
+				Type:     dns.TypeToString[q.key.rrtype],
+				Expected: expected[q.key],
+				Actual:   actual,
+			}
+			if err != nil {
+				m.Error = err.Error()
+			}
+
+			next = append(next, q)
+			v.Mismatch = append(v.Mismatch, m)
+		}
+
+		pending = next
+		if len(pending) == 0 || time.Now().Add(c.Interval).After(deadline) {
+			break
+		}
+
+		common.Verbose.Printf("verify : attempt %d : %d mismatch\n", v.Attempt, len(pending))
+		time.Sleep(c.Interval)
+	}
+
+	v.Duration = time.Since(start)
+	v.OK = len(v.Mismatch) == 0
+
+	if !v.OK {
+		for _, m := range v.Mismatch {
+			log.Printf("verify %s : %s %s : expected %v, actual %v %s\n", m.Server, m.Name, m.Type, m.Expected, m.Actual, m.Error)
+		}
+		sentry.CaptureMessage(fmt.Sprintf("verify : %d mismatch after %d attempts", len(v.Mismatch), v.Attempt))
+	}
+
+	return v
+}
+
+// 응답 중 해당 타입만 정렬해서.
+// RPZ 는 재귀 질의에만 적용되므로 RD 를 켜고, 다시 쓴 응답은 AA 가 없으므로 확인하지 않는다
+func queryRecord(server string, key dnsRecordKey) ([]string, error) {
+	client := dns.Client{
+		Net:     "udp",
+		Timeout: cfg.V.DNS.Verify.Timeout,
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(key.name), key.rrtype)
+
+	res, _, err := client.Exchange(msg, server)
+	if err == nil && res.Truncated {
+		client.Net = "tcp"
+		res, _, err = client.Exchange(msg, server)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if res.Rcode != dns.RcodeSuccess {
+		return nil, errors.Errorf("rcode %s", dns.RcodeToString[res.Rcode])
+	}
+
+	actual := []string{}
+	for _, rr := range res.Answer {
+		if rr.Header().Rrtype == key.rrtype {
+			actual = append(actual, verifyValue(rr))
+		}
+	}
+	sort.Strings(actual)
+
+	return actual, nil
+}
@@ -29,13 +29,23 @@ func init() {
 			time.Sleep(time.Until(ltime))
 
 			reqJson := atomic.SwapUint64(&statJson, 0)
+			reqExplain := atomic.SwapUint64(&statExplain, 0)
+			reqFailure := atomic.SwapUint64(&statFailure, 0)
+			reqTamper := atomic.SwapUint64(&statTamper, 0)
+			reqDns := atomic.SwapUint64(&statDns, 0)
+			reqPublish := atomic.SwapUint64(&statPublish, 0)
 
 			fmt.Fprintf(
 				fs,
-				"[%s - %s] json : %6d\n",
+				"[%s - %s] json : %6d / explain : %6d / failure : %6d / tamper : %6d / publish : %6d / dns : %8d\n",
 				ltime.Format("2006-01-02 15:04:05"),
 				time.Now().Format("2006-01-02 15:04:05"),
 				reqJson,
+				reqExplain,
+				reqFailure,
+				reqTamper,
+				reqPublish,
+				reqDns,
 			)
 
 			ltime = ltime.Add(time.Hour)
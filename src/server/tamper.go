@@ -0,0 +1,43 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"twimgdns/src/common"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var (
+	statTamper uint64
+
+	httpTamper = responseCache{
+		dataBuff: bytes.NewBuffer(nil),
+		stat:     &statTamper,
+	}
+)
+
+type tamperReport struct {
+	UpdatedAt time.Time             `json:"updated_at"`
+	Tamper    []common.ResultTamper `json:"tamper"`
+}
+
+// 격리 중인 IP 를 호스트 구분 없이 모은다
+func setTamperData(data common.Result) {
+	r := tamperReport{
+		UpdatedAt: data.UpdatedAt,
+		Tamper:    []common.ResultTamper{},
+	}
+
+	for _, v := range data.Detail {
+		r.Tamper = append(r.Tamper, v.Tamper...)
+	}
+
+	httpTamper.update(
+		func(w io.Writer) error {
+			return jsoniter.NewEncoder(w).Encode(&r)
+		},
+	)
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+const zoneHistoryExt = ".zone"
+
+// zone 파일 쓰기와 되돌리기가 겹치지 않도록
+var zoneFileLock sync.Mutex
+
+func renderZone(data common.Result, serial time.Time) ([]byte, error) {
+	var td struct {
+		Serial string
+		Data   common.Result
+	}
+	td.Serial = serial.Format("0601021504")
+	td.Data = data
+
+	var buf bytes.Buffer
+	err := zoneTemplate.Execute(&buf, &td)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// 검사한 zone 의 내용. 훅과 게시 상태에서 쓴다
+type zoneInfo struct {
+	Version string // path.zone_history 에 남긴 이름. 남기지 않았으면 ""
+	Serial  uint32
+	Record  []dns.RR // A, AAAA. 새 결과를 쓴 경우에는 resultRecords
+}
+
+// 검사 결과로 만든 A, AAAA. 주소가 없는 호스트는 뺀다.
+// zone 파일을 다시 읽은 이름은 $ORIGIN 설정에 따라 달라지므로 dns.go 처럼 결과에서 바로 만든다
+func resultRecords(data common.Result) []dns.RR {
+	var l []dns.RR
+
+	for host, v := range data.Detail {
+		if v.Best.Addr == "" {
+			continue
+		}
+
+		name := strings.ToLower(dns.Fqdn(host))
+		if ip := net.ParseIP(v.Best.Addr); ip != nil && ip.To4() != nil {
+			l = append(l, &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET}, A: ip.To4()})
+		}
+		if ip := net.ParseIP(v.BestV6.Addr); ip != nil && ip.To4() == nil {
+			l = append(l, &dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET}, AAAA: ip})
+		}
+	}
+
+	sort.Slice(l, func(i, k int) bool {
+		if l[i].Header().Name != l[k].Header().Name {
+			return l[i].Header().Name < l[k].Header().Name
+		}
+		return l[i].Header().Rrtype < l[k].Header().Rrtype
+	})
+
+	return l
+}
+
+// BIND 에 넘기기 전에 다시 읽어본다. SOA 가 없거나 문법이 틀리면 오류
+func validateZone(zone []byte) (info zoneInfo, err error) {
+	origin := cfg.V.DNS.ZoneFile.Origin
+	if origin == "" {
+		origin = "."
+	}
+
+	zp := dns.NewZoneParser(bytes.NewReader(zone), dns.Fqdn(origin), cfg.V.Path.ZoneFile)
+
+	var soa bool
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr := rr.(type) {
+		case *dns.SOA:
+			soa = true
+			info.Serial = rr.Serial
+		case *dns.A, *dns.AAAA:
+			info.Record = append(info.Record, rr)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return info, errors.WithStack(err)
+	}
+	if !soa {
+		return info, errors.New("zone : no SOA record")
+	}
+
+	return info, nil
+}
+
+// 검사한 뒤에 path.zone_history 에 남기고 바꾼다.
+// 기록을 남기지 못해도 zone 파일은 바꾼다. 오류를 돌려주면 훅이 실행되지 않는다
+func writeZoneFile(zone []byte) (zoneInfo, error) {
+	info, err := validateZone(zone)
+	if err != nil {
+		return info, err
+	}
+
+	history := cfg.V.Path.ZoneHistory != "" && cfg.V.DNS.ZoneFile.Keep > 0
+	if history {
+		version := time.Now().Format("20060102-150405.000")
+		err = common.WriteFileAtomic(filepath.Join(cfg.V.Path.ZoneHistory, version+zoneHistoryExt), 0644, func(w io.Writer) error {
+			_, err := w.Write(zone)
+			return err
+		})
+		if err != nil {
+			sentry.CaptureException(err)
+			log.Printf("zone history : %v\n", err)
+		} else {
+			info.Version = version
+		}
+	}
+
+	err = common.WriteFileAtomic(cfg.V.Path.ZoneFile, 0644, func(w io.Writer) error {
+		_, err := w.Write(zone)
+		return err
+	})
+	if err != nil {
+		return info, err
+	}
+
+	if history {
+		l := zoneHistoryList()
+		for i := cfg.V.DNS.ZoneFile.Keep; i < len(l); i++ {
+			os.Remove(filepath.Join(cfg.V.Path.ZoneHistory, l[i]+zoneHistoryExt))
+		}
+	}
+
+	return info, nil
+}
+
+// 최신 버전부터
+func zoneHistoryList() []string {
+	fis, err := ioutil.ReadDir(cfg.V.Path.ZoneHistory)
+	if err != nil {
+		return nil
+	}
+
+	l := make([]string, 0, len(fis))
+	for _, fi := range fis {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), zoneHistoryExt) {
+			l = append(l, strings.TrimSuffix(fi.Name(), zoneHistoryExt))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(l)))
+
+	return l
+}
+
+type zoneVersion struct {
+	Version string    `json:"version"`
+	Size    int64     `json:"size"`
+	Current bool      `json:"current"` // 지금 zone 파일과 내용이 같음
+	ModTime time.Time `json:"mod_time"`
+}
+
+func checkAuth(ctx *gin.Context) bool {
+	if ctx.GetHeader(common.UpdateHeaderName) != cfg.UpdateHeaderValue {
+		ctx.Status(http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// ctx.JSON 은 encoding/json 이라 data.go 에 등록한 time.Time 형식이 적용되지 않는다
+func writeJson(ctx *gin.Context, code int, v interface{}) {
+	b, err := jsoniter.Marshal(v)
+	if err != nil {
+		sentry.CaptureException(err)
+		ctx.Status(http.StatusInternalServerError)
+		return
+	}
+	ctx.Data(code, "application/json; charset=utf-8", b)
+}
+
+func handleZoneHistory(ctx *gin.Context) {
+	if !checkAuth(ctx) {
+		return
+	}
+
+	var current [sha256.Size]byte
+	if b, err := ioutil.ReadFile(cfg.V.Path.ZoneFile); err == nil {
+		current = sha256.Sum256(b)
+	}
+
+	l := []zoneVersion{}
+	for _, version := range zoneHistoryList() {
+		path := filepath.Join(cfg.V.Path.ZoneHistory, version+zoneHistoryExt)
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		l = append(
+			l,
+			zoneVersion{
+				Version: version,
+				Size:    fi.Size(),
+				Current: sha256.Sum256(b) == current,
+				ModTime: fi.ModTime(),
+			},
+		)
+	}
+
+	writeJson(ctx, http.StatusOK, l)
+}
+
+// 이전 버전을 다시 검사해서 zone 파일로 쓴다. 되돌린 것도 새 버전으로 남는다
+func handleZoneRollback(ctx *gin.Context) {
+	if !checkAuth(ctx) {
+		return
+	}
+
+	version := ctx.Param("version")
+	if strings.ContainsAny(version, `/\`) || strings.HasPrefix(version, ".") {
+		ctx.Status(http.StatusBadRequest)
+		return
+	}
+
+	zoneFileLock.Lock()
+	defer zoneFileLock.Unlock()
+
+	zone, err := ioutil.ReadFile(filepath.Join(cfg.V.Path.ZoneHistory, version+zoneHistoryExt))
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	info, err := writeZoneFile(zone)
+	if err != nil {
+		sentry.CaptureException(err)
+		ctx.String(http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	s := publishZone(publishSourceRollback, info)
+	if !s.OK {
+		writeJson(ctx, http.StatusBadGateway, &s)
+		return
+	}
+
+	writeJson(ctx, http.StatusOK, &s)
+}
@@ -0,0 +1,412 @@
+package tester
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+
+	"github.com/getsentry/sentry-go"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+)
+
+const (
+	sourceTypeResolver   = "resolver"
+	sourceTypePassiveDns = "passive_dns"
+	sourceTypeFile       = "file"
+	sourceTypePublished  = "published"
+	sourceTypeEcs        = "ecs"
+
+	// 파일에 적힌 CIDR 은 이 크기까지만 펼친다
+	maxCidrHostBits = 8
+)
+
+// CDN 후보 IP 를 수집하는 곳
+type candidateSource interface {
+	collect(td *cdnTestHostData)
+}
+
+var candidateSources []candidateSource
+
+func newCandidateSources() []candidateSource {
+	if len(cfg.V.Test.Source) == 0 {
+		return []candidateSource{&resolverSource{name: sourceTypeResolver}}
+	}
+
+	l := make([]candidateSource, 0, len(cfg.V.Test.Source))
+	for _, c := range cfg.V.Test.Source {
+		if c.Disable {
+			continue
+		}
+
+		name := c.Name
+		if name == "" {
+			name = c.Type
+		}
+
+		switch c.Type {
+		case sourceTypeResolver:
+			l = append(l, &resolverSource{name: name})
+
+		case sourceTypePassiveDns:
+			var path []interface{}
+			if c.JsonPath != "" {
+				for _, key := range strings.Split(c.JsonPath, ".") {
+					path = append(path, key)
+				}
+			}
+
+			l = append(
+				l,
+				&passiveDnsSource{
+					name:       name,
+					url:        c.URL,
+					path:       path,
+					ipKey:      c.IPKey,
+					dateKey:    c.DateKey,
+					dateFormat: c.DateFormat,
+					expire:     c.Expire,
+				},
+			)
+
+		case sourceTypeFile:
+			l = append(l, &fileSource{name: name, path: c.File})
+
+		case sourceTypePublished:
+			l = append(l, &publishedSource{name: name, url: c.URL})
+
+		case sourceTypeEcs:
+			subnet := make([]*net.IPNet, 0, len(c.Subnet))
+			for _, v := range c.Subnet {
+				_, ipNet, err := net.ParseCIDR(v)
+				if err != nil {
+					panic(err)
+				}
+				subnet = append(subnet, ipNet)
+			}
+
+			l = append(l, &ecsSource{name: name, nameServer: c.NameServer, subnet: subnet})
+
+		default:
+			panic(fmt.Sprintf("unknown candidate source type : %s", c.Type))
+		}
+	}
+
+	return l
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+// 네임서버 전체에 질의
+
+type resolverSource struct {
+	name string
+}
+
+func (s *resolverSource) collect(td *cdnTestHostData) {
+	for _, host := range td.hostList {
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		s.collectHost(td, host)
+	}
+}
+
+func (s *resolverSource) collectHost(td *cdnTestHostData, host string) {
+	if !strings.HasSuffix(host, ".") {
+		host = host + "."
+	}
+
+	var w sync.WaitGroup
+	chDnsAddr := make(chan []string, cfg.V.Test.Worker.Resolve)
+
+	for i := 0; i < cfg.V.Test.Worker.Resolve; i++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+
+			for dnsAddr := range chDnsAddr {
+				for _, qtype := range queryTypes() {
+					r, ok := resolve(dnsAddr, host, qtype)
+					if !ok {
+						atomic.AddInt64(&td.dnsFailure, 1)
+						continue
+					}
+
+					for _, ip := range r.addr {
+						td.addCandidate(
+							ip,
+							cdnTestHostDataResult{
+								source:     s.name,
+								nameServer: dnsAddr,
+								cname:      r.cname,
+							},
+						)
+					}
+				}
+			}
+		}()
+	}
+
+	for _, addr := range td.p.nameServer {
+		chDnsAddr <- addr
+	}
+	close(chDnsAddr)
+
+	w.Wait()
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+// Passive DNS (JSON)
+
+type passiveDnsSource struct {
+	name string
+	url  string // {host} 는 검사할 호스트로 치환
+	path []interface{}
+
+	ipKey      string
+	dateKey    string
+	dateFormat string
+	expire     time.Duration
+}
+
+func (s *passiveDnsSource) collect(td *cdnTestHostData) {
+	for _, host := range td.hostList {
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		s.collectHost(td, host)
+	}
+}
+
+func (s *passiveDnsSource) collectHost(td *cdnTestHostData, host string) {
+	res, err := httpClient.Get(strings.ReplaceAll(s.url, "{host}", url.QueryEscape(host)))
+	if err != nil {
+		sentry.CaptureException(err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		common.Verbose.Printf("[%s] %s : %s\n", td.host, s.name, res.Status)
+		return
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		sentry.CaptureException(err)
+		return
+	}
+
+	list := jsoniter.Get(body, s.path...)
+	if list.ValueType() != jsoniter.ArrayValue {
+		sentry.CaptureException(errors.Errorf("%s : json_path is not an array", s.name))
+		return
+	}
+
+	minDate := time.Now().Add(s.expire * -1)
+
+	for i := 0; i < list.Size(); i++ {
+		item := list.Get(i)
+
+		if s.dateKey != "" && s.expire > 0 {
+			lastResolved, err := time.Parse(s.dateFormat, item.Get(s.dateKey).ToString())
+			if err != nil || lastResolved.Before(minDate) {
+				continue
+			}
+		}
+
+		if s.ipKey != "" {
+			item = item.Get(s.ipKey)
+		}
+
+		td.addCandidate(net.ParseIP(item.ToString()), cdnTestHostDataResult{source: s.name})
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+// IP / CIDR 목록 파일
+// 한 줄에 하나씩 "주소 [호스트...]". 호스트를 적으면 해당 호스트 검사에만 사용한다.
+
+type fileSource struct {
+	name string
+	path string
+}
+
+func (s *fileSource) collect(td *cdnTestHostData) {
+	fs, err := os.Open(s.path)
+	if err != nil {
+		sentry.CaptureException(err)
+		return
+	}
+	defer fs.Close()
+
+	sc := bufio.NewScanner(fs)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) > 1 {
+			matched := false
+			for _, host := range fields[1:] {
+				if strings.EqualFold(host, td.host) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		if !strings.Contains(fields[0], "/") {
+			td.addCandidate(net.ParseIP(fields[0]), cdnTestHostDataResult{source: s.name})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			log.Printf("%s : %s : %v\n", s.name, fields[0], err)
+			continue
+		}
+
+		ones, bits := ipNet.Mask.Size()
+		if bits-ones > maxCidrHostBits {
+			log.Printf("%s : %s : too large\n", s.name, fields[0])
+			continue
+		}
+
+		for ip := ipNet.IP; ipNet.Contains(ip); ip = nextIP(ip) {
+			td.addCandidate(ip, cdnTestHostDataResult{source: s.name})
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		sentry.CaptureException(err)
+	}
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+
+	return next
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+// 이전에 배포한 결과 (/json.2)
+
+type publishedSource struct {
+	name string
+	url  string
+}
+
+func (s *publishedSource) collect(td *cdnTestHostData) {
+	res, err := httpClient.Get(s.url)
+	if err != nil {
+		sentry.CaptureException(err)
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		sentry.CaptureException(err)
+		return
+	}
+
+	data := jsoniter.Get(body, "detail", td.host)
+	for _, key := range []string{"best", "best_v6"} {
+		if addr := data.Get(key, "addr").ToString(); addr != "" {
+			td.addCandidate(net.ParseIP(addr), cdnTestHostDataResult{source: s.name})
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+// EDNS Client Subnet 으로 지역별 엣지 탐색
+
+type ecsSource struct {
+	name       string
+	nameServer []string // 비어있으면 권한 있는 네임서버에 직접 질의
+	subnet     []*net.IPNet
+}
+
+func (s *ecsSource) collect(td *cdnTestHostData) {
+	for _, host := range td.hostList {
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		s.collectHost(td, host)
+	}
+}
+
+func (s *ecsSource) collectHost(td *cdnTestHostData, host string) {
+	var w sync.WaitGroup
+	chSubnet := make(chan *net.IPNet, cfg.V.Test.Worker.Resolve)
+
+	for i := 0; i < cfg.V.Test.Worker.Resolve; i++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+
+			for subnet := range chSubnet {
+				for _, qtype := range queryTypes() {
+					r, ok := resolveSubnet(s.nameServer, host, qtype, subnet)
+					if !ok {
+						atomic.AddInt64(&td.dnsFailure, 1)
+						continue
+					}
+
+					for _, ip := range r.addr {
+						td.addCandidate(
+							ip,
+							cdnTestHostDataResult{
+								source:     s.name,
+								nameServer: s.nameServer,
+								subnet:     subnet.String(),
+								cname:      r.cname,
+							},
+						)
+					}
+				}
+			}
+		}()
+	}
+
+	for _, subnet := range s.subnet {
+		chSubnet <- subnet
+	}
+	close(chSubnet)
+
+	w.Wait()
+}
@@ -2,15 +2,15 @@ package tester
 
 import (
 	"bytes"
-	"context"
 	"crypto/sha256"
 	"crypto/tls"
-	"encoding/binary"
+	"fmt"
 	"io"
 	"log"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,7 +19,6 @@ import (
 	"twimgdns/src/common"
 	"twimgdns/src/common/cfg"
 
-	"github.com/asmpro/go-ping"
 	"github.com/dustin/go-humanize"
 	"github.com/getsentry/sentry-go"
 	jsoniter "github.com/json-iterator/go"
@@ -38,8 +37,6 @@ func newHttpClient() *http.Client {
 	return &http.Client{
 		Timeout: cfg.V.HTTP.Client.Timeout.Timeout,
 		Transport: &http.Transport{
-			//ForceAttemptHTTP2: true,
-
 			TLSClientConfig: &tls.Config{
 				MinVersion: tls.VersionTLS12,
 			},
@@ -52,20 +49,36 @@ func newHttpClient() *http.Client {
 	}
 }
 
-func ip2int(ip net.IP) uint32 {
-	if len(ip) == net.IPv4len {
-		binary.BigEndian.Uint32(ip)
+type ipKey [net.IPv6len]byte
+
+func ip2key(ip net.IP) (k ipKey) {
+	copy(k[:], ip.To16())
+	return
+}
+
+// IPv6 검사를 끄면 IPv4 주소만 후보로 받는다
+func acceptIP(ip net.IP) bool {
+	return ip != nil && (ip.To4() != nil || cfg.V.Test.IPv6)
+}
+
+func queryTypes() []uint16 {
+	if cfg.V.Test.IPv6 {
+		return []uint16{dns.TypeA, dns.TypeAAAA}
 	}
-	return binary.BigEndian.Uint32(ip[len(ip)-4:])
+	return []uint16{dns.TypeA}
 }
 
 type cdnTest struct {
 	nameServer    [][]string
-	nameServerMap map[uint32]struct{}
+	nameServerMap map[ipKey]struct{}
+
+	history candidateHistory
 }
 
 func (ct *cdnTest) do() {
-	ct.nameServerMap = make(map[uint32]struct{})
+	ct.nameServerMap = make(map[ipKey]struct{})
+	ct.history = loadCandidateHistory()
+	resetAuthoritativeNameServer()
 
 	result := common.Result{
 		Detail: make(map[string]common.ResultData, 2),
@@ -77,7 +90,7 @@ func (ct *cdnTest) do() {
 		for _, nameserver := range namerserverList {
 			if ip := net.ParseIP(nameserver); ip != nil && ip.To4() != nil {
 				l = append(l, nameserver)
-				ct.nameServerMap[ip2int(ip)] = struct{}{}
+				ct.nameServerMap[ip2key(ip)] = struct{}{}
 			}
 		}
 
@@ -89,6 +102,8 @@ func (ct *cdnTest) do() {
 
 	common.Verbose.Printf("nameserver Count : %d\n", len(ct.nameServer))
 
+	var tamper []common.ResultTamper
+
 	for host, hostInfo := range cfg.V.Test.Host {
 		td := cdnTestHostData{
 			p:            ct,
@@ -100,13 +115,23 @@ func (ct *cdnTest) do() {
 
 		log.Printf("[%s] Best    : %15s / ping : %6.2f ms / http : %7s/s\n", host, td.result.Best.Addr, td.result.Best.Ping.Seconds()*1000, humanize.IBytes(uint64(td.result.Best.Speed)))
 		log.Printf("[%s] Default : %15s / ping : %6.2f ms / http : %7s/s\n", host, td.result.Default.Addr, td.result.Default.Ping.Seconds()*1000, humanize.IBytes(uint64(td.result.Default.Speed)))
+		if td.result.BestV6.Addr != "" {
+			log.Printf("[%s] Best6   : %15s / ping : %6.2f ms / http : %7s/s\n", host, td.result.BestV6.Addr, td.result.BestV6.Ping.Seconds()*1000, humanize.IBytes(uint64(td.result.BestV6.Speed)))
+		}
+		if td.result.DefaultV6.Addr != "" {
+			log.Printf("[%s] Default6: %15s / ping : %6.2f ms / http : %7s/s\n", host, td.result.DefaultV6.Addr, td.result.DefaultV6.Ping.Seconds()*1000, humanize.IBytes(uint64(td.result.DefaultV6.Speed)))
+		}
 
 		result.Detail[host] = td.result
+		tamper = append(tamper, td.tamper...)
 	}
 
 	result.UpdatedAt = time.Now()
 
+	ct.history.save()
+
 	go updateServer(result)
+	go sendTamperWebhook(tamper)
 }
 
 func (ct *cdnTest) getPublicDNSServerList(url string) {
@@ -128,7 +153,7 @@ func (ct *cdnTest) getPublicDNSServerList(url string) {
 
 	for _, dns := range dnsList {
 		if ip := net.ParseIP(dns.Ip); ip != nil && ip.To4() != nil {
-			ipi := ip2int(ip)
+			ipi := ip2key(ip)
 
 			if _, ok := ct.nameServerMap[ipi]; !ok {
 				ct.nameServer = append(ct.nameServer, []string{dns.Ip})
@@ -148,48 +173,121 @@ type cdnTestHostData struct {
 	dnsClient dns.Client
 
 	cdnAddrListLock sync.Mutex
-	cdnAddrList     map[uint32]*cdnTestHostDataResult
+	cdnAddrList     map[ipKey]*cdnTestHostDataResult
+	eliminated      []*cdnTestHostDataResult // 검사 중에 떨어진 후보
 
 	pingSum      int64 // Microseconds
 	pingSumCount int64
 
+	dnsFailure int64 // 시간 초과, 오류, NOERROR 가 아닌 응답을 받은 DNS 질의 수
+
+	tamperLock sync.Mutex
+	tamper     []common.ResultTamper // 이번 검사에서 발견한 것
+
 	result common.ResultData
 }
 
 type cdnTestHostDataResult struct {
 	addr       string
+	v6         bool
+	source     string
 	nameServer []string
+	subnet     string // ECS 로 찾은 경우
+	cname      []string
+	provider   string
+
+	tlsChecked bool
+	certIssuer string
+	certExpire time.Time
+
+	pingAve  time.Duration
+	pingStat []common.ResultPingStat
+
+	httpAve    float64
+	httpStat   common.ResultStat // 파일별 속도
+	httpTiming common.ResultHttpTiming
+
+	httpProtocol []common.ResultHttpProtocol // all 모드의 프로토콜별 결과
+	httpRange    []common.ResultHttpRange
+	httpParallel *common.ResultHttpParallel
 
-	pingAve time.Duration
-	httpAve float64
+	bufferbloat *common.ResultBufferbloat // 속도 검사 중 지연시간
+	curve       *common.ResultCurve
+
+	score common.ResultScore
+
+	failure  []common.ResultFailure // 검사 중 실패한 사유. 탈락하지 않은 것도 포함. failureLock
+	tampered bool
 
 	isDefault bool
 }
 
 func (td *cdnTestHostData) do() {
-	td.cdnAddrList = make(map[uint32]*cdnTestHostDataResult, 30)
+	td.cdnAddrList = make(map[ipKey]*cdnTestHostDataResult, 30)
 	td.dnsClient = dns.Client{
 		Net: "udp",
 	}
 
 	//////////////////////////////////////////////////
 
-	if ip, _ := resolve(cfg.V.DNS.NameServerDefault, td.host); ip != nil {
-		td.cdnAddrList[ip2int(ip)] = &cdnTestHostDataResult{
-			addr:       ip.String(),
-			nameServer: cfg.V.DNS.NameServerDefault,
-			isDefault:  true,
+	for _, qtype := range queryTypes() {
+		r, ok := resolve(cfg.V.DNS.NameServerDefault, td.host, qtype)
+		if !ok {
+			log.Printf("[%s] default nameserver : %s query failed\n", td.host, dns.TypeToString[qtype])
+			atomic.AddInt64(&td.dnsFailure, 1)
+		}
+		for _, ip := range r.addr {
+			td.addCandidate(
+				ip,
+				cdnTestHostDataResult{
+					source:     "default",
+					nameServer: cfg.V.DNS.NameServerDefault,
+					cname:      r.cname,
+					isDefault:  true,
+				},
+			)
 		}
 	}
 
 	for _, host := range td.hostList {
-		td.getCdnAddrFromNameServer(host)
-		td.getCdnAddrFromThreatCrowd(host)
+		if ip := net.ParseIP(host); ip != nil {
+			td.addCandidate(ip, cdnTestHostDataResult{source: "config"})
+		}
 	}
+
+	for _, source := range candidateSources {
+		source.collect(td)
+	}
+	td.p.history.inject(td)
 	common.Verbose.Printf("[%s] cdn count : %d\n", td.host, len(td.cdnAddrList))
 
+	if cfg.V.Test.Neighbour.Enable {
+		common.Verbose.Printf("[%s] neighbour start\n", td.host)
+		td.neighbourSweep()
+		common.Verbose.Printf("[%s] neighbour done (%d)\n", td.host, len(td.cdnAddrList))
+	}
+
+	now := time.Now()
+	td.p.history.seen(td, now)
+	td.quarantineFilter(now)
+
+	providerCount := make(map[string]int)
+	for _, data := range td.cdnAddrList {
+		providerCount[data.provider]++
+	}
+	for provider, count := range providerCount {
+		if provider == "" {
+			provider = "unknown"
+		}
+		common.Verbose.Printf("[%s] cdn count : %-10s : %d\n", td.host, provider, count)
+	}
+
 	//////////////////////////////////////////////////
 
+	common.Verbose.Printf("[%s] tls start\n", td.host)
+	td.tlsFilter()
+	common.Verbose.Printf("[%s] tls done (%d)\n", td.host, len(td.cdnAddrList))
+
 	common.Verbose.Printf("[%s] ping start\n", td.host)
 	td.pingAndFilter()
 	common.Verbose.Printf("[%s] ping done (%d)\n", td.host, len(td.cdnAddrList))
@@ -198,121 +296,93 @@ func (td *cdnTestHostData) do() {
 	td.httpSpeedTest()
 	common.Verbose.Printf("[%s] http done (%d)\n", td.host, len(td.cdnAddrList))
 
+	td.score()
+
 	//////////////////////////////////////////////////
 
-	var maxHttpAve float64
+	var maxRank, maxRankV6 float64
 	for _, data := range td.cdnAddrList {
-		if maxHttpAve < data.httpAve {
-			maxHttpAve = data.httpAve
-			td.result.Best = common.ResultDataCdn{
-				Addr:  data.addr,
-				Ping:  data.pingAve,
-				Speed: data.httpAve,
+		cdn := data.resultDataCdn()
+
+		// 기본 DNS 가 여러 주소를 주면 그 중 가장 빠른 것을 기본값으로
+		rank := data.rank()
+		if data.v6 {
+			if maxRankV6 < rank {
+				maxRankV6 = rank
+				td.result.BestV6 = cdn
 			}
-		}
-
-		if data.isDefault {
-			td.result.Default = common.ResultDataCdn{
-				Addr:  data.addr,
-				Ping:  data.pingAve,
-				Speed: data.httpAve,
+			if data.isDefault && (td.result.DefaultV6.Addr == "" || td.result.DefaultV6.Score.Score < rank) {
+				td.result.DefaultV6 = cdn
 			}
-		}
-	}
-}
-
-func (td *cdnTestHostData) getCdnAddrFromNameServer(host string) {
-	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
-		ipi := ip2int(ip)
-		if _, ok := td.cdnAddrList[ipi]; !ok {
-			td.cdnAddrList[ipi] = &cdnTestHostDataResult{
-				addr: ip.String(),
+		} else {
+			if maxRank < rank {
+				maxRank = rank
+				td.result.Best = cdn
+			}
+			if data.isDefault && (td.result.Default.Addr == "" || td.result.Default.Score.Score < rank) {
+				td.result.Default = cdn
 			}
 		}
-		return
 	}
 
-	if !strings.HasSuffix(host, ".") {
-		host = host + "."
+	// 모두 임계값에 걸렸으면 기본 DNS 의 응답을 그대로 쓴다
+	if td.result.Best.Addr == "" {
+		td.result.Best = td.result.Default
 	}
-
-	var w sync.WaitGroup
-	chDnsAddr := make(chan []string, cfg.V.Test.Worker.Resolve)
-
-	for i := 0; i < cfg.V.Test.Worker.Resolve; i++ {
-		w.Add(1)
-		go func() {
-			defer w.Done()
-
-			for dnsAddr := range chDnsAddr {
-				ip, ok := resolve(dnsAddr, host)
-				if !ok {
-					continue
-				}
-
-				if ip != nil && ip.To4() != nil {
-					ipi := ip2int(ip)
-
-					td.cdnAddrListLock.Lock()
-					if _, ok := td.cdnAddrList[ipi]; !ok {
-						td.cdnAddrList[ipi] = &cdnTestHostDataResult{
-							addr:       ip.String(),
-							nameServer: dnsAddr,
-						}
-					}
-					td.cdnAddrListLock.Unlock()
-				}
-			}
-		}()
+	if td.result.BestV6.Addr == "" {
+		td.result.BestV6 = td.result.DefaultV6
 	}
 
-	for _, addr := range td.p.nameServer {
-		chDnsAddr <- addr
-	}
-	close(chDnsAddr)
+	td.result.Candidate = td.candidateList()
+	td.result.FailureCount = td.failureCount()
+	td.logFailure()
 
-	w.Wait()
+	td.p.history.update(td, now)
+	td.result.Tamper = td.tamperList(now)
 }
 
-func (td *cdnTestHostData) getCdnAddrFromThreatCrowd(host string) {
-	res, err := httpClient.Get("https://www.threatcrowd.org/searchApi/v2/domain/report/?domain=" + host)
-	if err != nil {
-		sentry.CaptureException(err)
+func (data *cdnTestHostDataResult) rank() float64 {
+	return data.score.Score
+}
+
+// c 에는 수집 경로만 채워서 넘긴다. 이미 있는 주소면 CNAME 정보만 보충한다.
+func (td *cdnTestHostData) addCandidate(ip net.IP, c cdnTestHostDataResult) {
+	if !acceptIP(ip) {
 		return
 	}
-	defer res.Body.Close()
 
-	var jd struct {
-		Resolutions []struct {
-			IpAdddress   string `json:"ip_address"`
-			LastResolved string `json:"last_resolved"`
-		} `json:"resolutions"`
-	}
-	err = jsoniter.NewDecoder(res.Body).Decode(&jd)
-	if err != nil {
-		sentry.CaptureException(err)
+	ipi := ip2key(ip)
+
+	td.cdnAddrListLock.Lock()
+	defer td.cdnAddrListLock.Unlock()
+
+	if data, ok := td.cdnAddrList[ipi]; ok {
+		if len(data.cname) == 0 && len(c.cname) != 0 {
+			data.cname = c.cname
+			data.provider = cdnProvider(c.cname)
+		}
 		return
 	}
 
-	minDate := time.Now().Add(cfg.V.Test.ThreatCrowdExpire * -1)
+	c.addr = ip.String()
+	c.v6 = ip.To4() == nil
+	c.provider = cdnProvider(c.cname)
+	td.cdnAddrList[ipi] = &c
+}
 
-	for _, resolution := range jd.Resolutions {
-		lastResolved, err := time.Parse("2006-01-02", resolution.LastResolved)
-		if err != nil || lastResolved.Before(minDate) {
-			continue
-		}
+// CNAME 의 도메인으로 CDN 사업자 구분
+func cdnProvider(cname []string) string {
+	for i := len(cname) - 1; i >= 0; i-- {
+		name := strings.TrimSuffix(strings.ToLower(cname[i]), ".")
 
-		ip := net.ParseIP(resolution.IpAdddress)
-		if ip.To4() != nil {
-			ipi := ip2int(ip)
-			if _, ok := td.cdnAddrList[ipi]; !ok {
-				td.cdnAddrList[ipi] = &cdnTestHostDataResult{
-					addr:       ip.String(),
-					nameServer: []string{"Threat Crowd"},
-				}
+		for suffix, provider := range cfg.V.Test.CdnProvider {
+			if name == suffix || strings.HasSuffix(name, "."+suffix) {
+				return provider
 			}
 		}
 	}
+
+	return ""
 }
 
 func (td *cdnTestHostData) pingAndFilter() {
@@ -325,20 +395,22 @@ func (td *cdnTestHostData) pingAndFilter() {
 			defer w.Done()
 
 			for cdnData := range chCdnData {
-				pinger, _ := ping.NewPinger(cdnData.addr)
-				pinger.Count = cfg.V.Test.PingCount
-				pinger.Timeout = cfg.V.Test.PingTimeout
-
-				pinger.SetPrivileged(true)
-				pinger.Run()
+				// 첫번째 방식으로 필터링하고, 나머지는 기록만 한다
+				for _, mode := range pingModes() {
+					stat := probeLatency(mode, cdnData.addr)
+					if stat.Recv < cfg.V.Test.PingCount {
+						cdnData.fail(pingFailureKind(mode), fmt.Sprintf("%s %d/%d", mode, stat.Recv, stat.Sent))
+					}
+					cdnData.pingStat = append(cdnData.pingStat, stat)
+				}
 
-				stats := pinger.Statistics()
-				if !cdnData.isDefault && (stats.PacketsRecv != cfg.V.Test.PingCount || stats.PacketsSent != cfg.V.Test.PingCount) {
+				stats := cdnData.pingStat[0]
+				if !cdnData.isDefault && (stats.Recv != cfg.V.Test.PingCount || stats.Sent != cfg.V.Test.PingCount) {
 					continue
 				}
 
-				cdnData.pingAve = stats.AvgRtt
-				atomic.AddInt64(&td.pingSum, int64(stats.AvgRtt))
+				cdnData.pingAve = stats.Avg
+				atomic.AddInt64(&td.pingSum, int64(stats.Avg))
 				atomic.AddInt64(&td.pingSumCount, 1)
 
 				common.Verbose.Printf("[%s] ping %15s : %8.2f ms\n", td.host, cdnData.addr, float64(cdnData.pingAve)/float64(time.Millisecond))
@@ -368,10 +440,6 @@ func (td *cdnTestHostData) pingAndFilter() {
 }
 
 func (td *cdnTestHostData) httpSpeedTest() {
-	type testData struct {
-		url  string
-		hash []byte
-	}
 	testDataList := make([]testData, 0, len(td.hostTestData))
 	for url, hash := range td.hostTestData {
 		testDataList = append(
@@ -383,103 +451,139 @@ func (td *cdnTestHostData) httpSpeedTest() {
 		)
 	}
 
-	Tf := func(client *http.Client, cdnData *cdnTestHostDataResult) float64 {
-		h := sha256.New()
+	// 모든 후보가 같은 조각을 받도록 미리 정해둔다
+	rangePlan := td.rangePlan()
 
-		tr := client.Transport.(*http.Transport)
-		tr.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			host, port, _ := net.SplitHostPort(addr)
+	protocols := httpProtocols(td.host)
 
-			var dialer net.Dialer
-			c, err := dialer.DialContext(ctx, network, net.JoinHostPort(cdnData.addr, port))
-			if err != nil {
-				return nil, err
-			}
+	// 연결할 주소는 c.target 으로 미리 정해둔다. stream 은 동시 검사의 번호 (1 부터), 순차 검사면 0
+	Tf := func(c *speedTestClient, proto string, stream int, cdnData *cdnTestHostDataResult, curve *throughputCurve) (r common.ResultHttpProtocol, downloaded uint64) {
+		r.Protocol = proto
 
-			tconfig := tr.TLSClientConfig.Clone()
-			tconfig.ServerName = host
-
-			tc := tls.Client(c, tconfig)
-
-			errChannel := make(chan error, 1)
-			go func() {
-				errChannel <- tc.Handshake()
-			}()
-			select {
-			case <-ctx.Done():
-				tc.Close()
-				return nil, http.ErrHandlerTimeout
-			case err = <-errChannel:
-				if err != nil {
-					return nil, err
-				}
-			}
+		h := sha256.New()
 
-			go func() {
-				errChannel <- tc.VerifyHostname(host)
-			}()
-			select {
-			case <-ctx.Done():
-				tc.Close()
-				return nil, http.ErrHandlerTimeout
-			case err = <-errChannel:
-				if err != nil {
-					return nil, err
-				}
-			}
+		client := c.client
 
-			return tc, nil
+		// all 모드에서는 어느 프로토콜에서 실패했는지 남긴다
+		fail := func(kind string, detail string) {
+			if stream > 0 {
+				detail = fmt.Sprintf("stream %d %s", stream, detail)
+			}
+			if len(protocols) > 1 {
+				detail = proto + " " + detail
+			}
+			cdnData.fail(kind, detail)
 		}
 
-		var downloaded uint64 = 0
 		startTime := time.Now()
 
 		var testCase int = 0
+		var timing []common.ResultHttpTiming
+		var speed []float64
+		rangeSpeed := make(map[int64][]float64)
+
+		// 동시 검사는 순차 검사 한번 분량을 스트림끼리 나눠 받는다
+		maxCount, maxSize := cfg.V.Test.HttpTestMaxCount, cfg.V.Test.HttpTestSize
+		plan := rangePlan
+		if stream > 0 {
+			share := cfg.V.Test.Parallel
+			maxCount = (maxCount + share - 1) / share
+			maxSize /= uint64(share)
+
+			if len(rangePlan) > 0 {
+				plan = nil
+				for i := (stream - 1) % len(rangePlan); i < len(rangePlan); i += share {
+					plan = append(plan, rangePlan[i])
+				}
+			}
+		}
 
-		for testCase < cfg.V.Test.HttpTestMaxCount && downloaded < cfg.V.Test.HttpTestSize {
+		next := func() (d testData, ok bool) {
+			if rangePlan != nil {
+				if testCase < len(plan) {
+					d, ok = plan[testCase], true
+				}
+			} else if testCase < maxCount && downloaded < maxSize {
+				d, ok = testDataList[rand.Intn(len(testDataList))], true
+			}
 			testCase++
+			return
+		}
 
-			d := testDataList[rand.Intn(len(testDataList))]
+		for {
+			d, ok := next()
+			if !ok {
+				break
+			}
 
 			req, err := http.NewRequest("GET", d.url, nil)
 			if err != nil {
 				sentry.CaptureException(err)
-				return 0
+				fail(common.FailureHTTP, err.Error())
+				return
+			}
+			if d.size > 0 {
+				req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", d.offset, d.offset+d.size-1))
 			}
 
+			var ht httpTrace
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), ht.clientTrace()))
+
+			reqStartTime := time.Now()
+
 			res, err := client.Do(req)
 			if err != nil {
-				sentry.CaptureException(err)
+				fail(failureKind(err), err.Error())
 				if res != nil && res.Body != nil {
 					res.Body.Close()
 				}
-				return 0
+				return
 			}
 
-			if res.StatusCode != http.StatusOK {
-				log.Println(res.StatusCode, d.url, cdnData.addr)
+			if res.StatusCode != d.status() {
+				common.Verbose.Println(res.StatusCode, d.url, cdnData.addr)
+				fail(common.FailureHttpStatus, fmt.Sprintf("%d %s", res.StatusCode, d))
+				res.Body.Close()
 				continue
 			}
 
 			h.Reset()
-			wt, err := io.Copy(h, res.Body)
+			wt, err := io.Copy(h, curve.reader(res.Body))
+			res.Body.Close()
 
 			if err != nil && err != io.EOF {
-				sentry.CaptureException(err)
-				res.Body.Close()
-				return 0
+				fail(failureKind(err), err.Error())
+				return
 			}
 
-			if !bytes.Equal(h.Sum(nil), d.hash) {
-				log.Println("NEQ", d.url, cdnData.addr)
-				res.Body.Close()
-				return 0
+			if res.ContentLength >= 0 && wt != res.ContentLength {
+				fail(common.FailureTruncated, fmt.Sprintf("%d/%d %s", wt, res.ContentLength, d))
+				return
+			}
+
+			if sum := h.Sum(nil); !bytes.Equal(sum, d.hash) {
+				td.reportTamper(cdnData, d.String(), d.hash, sum)
+				return
+			}
+
+			ht.done = time.Now()
+			t := ht.timing()
+			t.Proto = res.Proto
+			timing = append(timing, t)
+			speed = append(speed, float64(wt)/ht.done.Sub(reqStartTime).Seconds())
+			if d.size > 0 {
+				rangeSpeed[d.size] = append(rangeSpeed[d.size], speed[len(speed)-1])
 			}
 
 			downloaded += uint64(wt)
 		}
 
-		return float64(downloaded) / time.Since(startTime).Seconds()
+		r.Speed = float64(downloaded) / time.Since(startTime).Seconds()
+		r.HttpStat = newSampleStat(speed)
+		r.HttpTiming = averageHttpTiming(timing)
+		r.Range = newRangeStat(rangeSpeed)
+
+		return
 	}
 
 	var w sync.WaitGroup
@@ -490,20 +594,72 @@ func (td *cdnTestHostData) httpSpeedTest() {
 		go func() {
 			defer w.Done()
 
-			client := newHttpClient()
-			var timeout time.Duration
+			clients := make([]*speedTestClient, len(protocols))
+			for i, proto := range protocols {
+				clients[i] = newSpeedTestClient(proto)
+			}
 
 			for cdnData := range chCdnData {
-				if cdnData.isDefault {
-					timeout = client.Timeout
-					client.Timeout = 0
-				}
-				cdnData.httpAve = Tf(client, cdnData)
-				if cdnData.httpAve != 0 {
-					common.Verbose.Printf("[%s] http %15s : %8s/s\n", td.host, cdnData.addr, humanize.IBytes(uint64(cdnData.httpAve)))
-				}
-				if cdnData.isDefault {
+				for i, proto := range protocols {
+					client := clients[i].client
+
+					timeout := client.Timeout
+					if cdnData.isDefault {
+						client.Timeout = 0
+					}
+					clients[i].target(cdnData.addr)
+
+					loaded := cfg.V.Test.LoadedPing.Enable && i == 0
+					var stopPing func() common.ResultPingStat
+					if loaded {
+						stopPing = startLoadedPing(cdnData.addr)
+					}
+					var curve *throughputCurve
+					if cfg.V.Test.Curve.Enable && i == 0 {
+						curve = startThroughputCurve()
+					}
+					r, _ := Tf(clients[i], proto, 0, cdnData, curve)
+					if curve != nil {
+						cdnData.curve = curve.stop()
+						if cdnData.curve.Throttled {
+							common.Verbose.Printf("[%s] http %15s : throttled %8s/s -> %8s/s\n", td.host, cdnData.addr, humanize.IBytes(uint64(cdnData.curve.Burst)), humanize.IBytes(uint64(cdnData.curve.Sustained)))
+						}
+					}
+					if loaded {
+						cdnData.setBufferbloat(stopPing())
+						if b := cdnData.bufferbloat; b != nil {
+							common.Verbose.Printf("[%s] ping %15s : idle %8.2f ms / loaded %8.2f ms\n", td.host, cdnData.addr, b.Idle, b.Loaded.Stat.Median)
+						}
+					}
+
+					// 동시 검사는 기준 프로토콜로만 한다
+					if i == 0 && cfg.V.Test.Parallel > 1 && r.Speed != 0 {
+						clients[i].target(cdnData.addr)
+						cdnData.httpParallel = parallelTest(cfg.V.Test.Parallel, r.Speed, func(stream int) (common.ResultHttpProtocol, uint64) {
+							return Tf(clients[i], proto, stream, cdnData, nil)
+						})
+						common.Verbose.Printf("[%s] http %15s : %s x%d %8s/s (x%.2f)\n", td.host, cdnData.addr, proto, cfg.V.Test.Parallel, humanize.IBytes(uint64(cdnData.httpParallel.Speed)), cdnData.httpParallel.Scaling)
+					}
 					client.Timeout = timeout
+
+					if r.Speed != 0 {
+						common.Verbose.Printf("[%s] http %15s : %s %8s/s (median %8s/s)\n", td.host, cdnData.addr, proto, humanize.IBytes(uint64(r.Speed)), humanize.IBytes(uint64(r.HttpStat.Median)))
+					}
+
+					// 첫번째 프로토콜로 순위를 매긴다
+					if i == 0 {
+						cdnData.httpAve = r.Speed
+						cdnData.httpStat = r.HttpStat
+						cdnData.httpTiming = r.HttpTiming
+						cdnData.httpRange = r.Range
+					}
+					if len(protocols) > 1 {
+						cdnData.httpProtocol = append(cdnData.httpProtocol, r)
+					}
+
+					if cdnData.tampered {
+						break
+					}
 				}
 			}
 		}()
@@ -517,8 +673,17 @@ func (td *cdnTestHostData) httpSpeedTest() {
 	w.Wait()
 
 	for k, data := range td.cdnAddrList {
+		// 내용이 바뀐 IP 는 기본 DNS 의 응답이라도 제외
+		if data.tampered {
+			td.eliminate(k)
+			continue
+		}
+
 		if !data.isDefault && (data.httpAve == 0) {
-			delete(td.cdnAddrList, k)
+			if len(data.failure) == 0 {
+				data.fail(common.FailureHTTP, "no successful response")
+			}
+			td.eliminate(k)
 			continue
 		}
 	}
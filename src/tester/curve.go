@@ -0,0 +1,99 @@
+package tester
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+)
+
+// 순차 속도 검사 한번(파일 여러 개) 동안 받은 양을 cfg.V.Test.Curve.Interval 마다 기록한다
+type throughputCurve struct {
+	bytes int64 // atomic
+
+	done   chan struct{}
+	result chan []int64
+}
+
+func checkCurve() {
+	if cfg.V.Test.Curve.Enable && cfg.V.Test.Curve.Interval <= 0 {
+		panic("curve.interval must be > 0")
+	}
+}
+
+func startThroughputCurve() *throughputCurve {
+	c := &throughputCurve{
+		done:   make(chan struct{}),
+		result: make(chan []int64, 1),
+	}
+
+	go func() {
+		var l []int64
+
+		ticker := time.NewTicker(cfg.V.Test.Curve.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.done:
+				c.result <- l
+				return
+			case <-ticker.C:
+				l = append(l, atomic.LoadInt64(&c.bytes))
+			}
+		}
+	}()
+
+	return c
+}
+
+// nil 이면 기록하지 않는다
+func (c *throughputCurve) reader(r io.Reader) io.Reader {
+	if c == nil {
+		return r
+	}
+	return &curveReader{r, c}
+}
+
+func (c *throughputCurve) stop() *common.ResultCurve {
+	close(c.done)
+	l := <-c.result
+
+	r := &common.ResultCurve{
+		Interval: cfg.V.Test.Curve.Interval,
+		Bytes:    l,
+	}
+
+	interval := cfg.V.Test.Curve.Interval.Seconds()
+	burst := int(cfg.V.Test.Curve.Burst / cfg.V.Test.Curve.Interval)
+	if burst < 1 {
+		burst = 1
+	}
+	if len(l) < burst {
+		return r
+	}
+
+	r.Burst = float64(l[burst-1]) / (float64(burst) * interval)
+	// 짧게 끝난 검사는 지속 속도를 알 수 없다
+	if len(l) > burst && r.Burst > 0 {
+		r.Sustained = float64(l[len(l)-1]-l[burst-1]) / (float64(len(l)-burst) * interval)
+		r.Ratio = r.Sustained / r.Burst
+		r.Throttled = r.Ratio < cfg.V.Test.Curve.ThrottleRatio
+		r.Measured = true
+	}
+
+	return r
+}
+
+type curveReader struct {
+	r io.Reader
+	c *throughputCurve
+}
+
+func (cr *curveReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	atomic.AddInt64(&cr.c.bytes, int64(n))
+	return n, err
+}
@@ -1,7 +1,13 @@
 package tester
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
 	"net"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -10,50 +16,202 @@ import (
 
 	"github.com/getsentry/sentry-go"
 	"github.com/miekg/dns"
+	"github.com/pkg/errors"
 )
 
-func resolve(dnsAddr []string, host string) (ip net.IP, ok bool) {
-	dnsClient := dns.Client{
-		Net:          "udp",
-		Timeout:      cfg.V.DNS.Client.Timeout.Timeout,
-		ReadTimeout:  cfg.V.DNS.Client.Timeout.ReadTimeout,
-		WriteTimeout: cfg.V.DNS.Client.Timeout.WriteTimeout,
-		DialTimeout:  cfg.V.DNS.Client.Timeout.DialTimeout,
+const maxCnameDepth = 8
+
+type resolveResult struct {
+	addr  []net.IP
+	cname []string // 질의한 이름에서부터 따라간 CNAME 순서
+}
+
+func resolve(dnsAddr []string, host string, qtype uint16) (res resolveResult, ok bool) {
+	return resolveChain(host, qtype, nil, func(string) []string { return dnsAddr })
+}
+
+// EDNS Client Subnet 을 붙여서 질의한다.
+// dnsAddr 가 없으면 각 이름의 권한 있는 네임서버에 직접 질의한다.
+func resolveSubnet(dnsAddr []string, host string, qtype uint16, subnet *net.IPNet) (res resolveResult, ok bool) {
+	if len(dnsAddr) == 0 {
+		return resolveChain(host, qtype, subnet, authoritativeNameServer)
 	}
+	return resolveChain(host, qtype, subnet, func(string) []string { return dnsAddr })
+}
 
+// ok 는 모든 질의가 NOERROR 로 응답했는지. 주소가 없는 응답 (NODATA) 도 ok
+func resolveChain(host string, qtype uint16, subnet *net.IPNet, nameServer func(host string) []string) (res resolveResult, ok bool) {
 	if !strings.HasSuffix(host, ".") {
 		host = host + "."
 	}
 
-	var msg dns.Msg
-	msg.SetQuestion(host, dns.TypeA)
+	for depth := 0; depth < maxCnameDepth; depth++ {
+		dnsAddr := nameServer(host)
+		if len(dnsAddr) == 0 {
+			return res, false
+		}
+
+		r := exchange(dnsAddr, newQuery(host, qtype, subnet))
+		if r == nil {
+			return res, false
+		}
+
+		addr, cname := parseAnswer(r, host, qtype)
+		res.addr = append(res.addr, addr...)
+		res.cname = append(res.cname, cname...)
+
+		// 응답에 CNAME 만 있으면 마지막 이름으로 다시 질의
+		if len(addr) > 0 || len(cname) == 0 {
+			break
+		}
+		host = cname[len(cname)-1]
+	}
+
+	return res, true
+}
+
+func newQuery(host string, qtype uint16, subnet *net.IPNet) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetQuestion(host, qtype)
 	msg.SetEdns0(4096, true)
 
-	rt := func(r *dns.Msg) (ip net.IP, ok bool) {
-		if r == nil || r.Rcode != dns.RcodeSuccess {
-			return nil, false
+	if subnet != nil {
+		ones, _ := subnet.Mask.Size()
+
+		ecs := &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			SourceNetmask: uint8(ones),
+		}
+		if ip := subnet.IP.To4(); ip != nil {
+			ecs.Family = 1
+			ecs.Address = ip
+		} else {
+			ecs.Family = 2
+			ecs.Address = subnet.IP
+		}
+
+		opt := msg.IsEdns0()
+		opt.Option = append(opt.Option, ecs)
+	}
+
+	return msg
+}
+
+var (
+	authNameServerLock sync.Mutex
+	authNameServer     = make(map[string][]string) // 검사 주기마다 초기화
+)
+
+func resetAuthoritativeNameServer() {
+	authNameServerLock.Lock()
+	authNameServer = make(map[string][]string)
+	authNameServerLock.Unlock()
+}
+
+// 상위 도메인으로 올라가면서 NS 레코드를 찾고, 그 네임서버들의 주소를 돌려준다.
+func authoritativeNameServer(host string) []string {
+	labels := dns.SplitDomainName(host)
+
+	for i := range labels {
+		zone := dns.Fqdn(strings.Join(labels[i:], "."))
+
+		authNameServerLock.Lock()
+		dnsAddr, ok := authNameServer[zone]
+		authNameServerLock.Unlock()
+		if ok {
+			if len(dnsAddr) == 0 {
+				continue
+			}
+			return dnsAddr
 		}
 
-		for _, ans := range r.Answer {
-			if ans.Header().Rrtype == dns.TypeA {
-				return ans.(*dns.A).A, true
+		var msg dns.Msg
+		msg.SetQuestion(zone, dns.TypeNS)
+
+		var nsList []string
+		if r := exchange(cfg.V.DNS.NameServerDefault, &msg); r != nil {
+			for _, ans := range r.Answer {
+				if ns, ok := ans.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, zone) {
+					nsList = append(nsList, ns.Ns)
+				}
 			}
 		}
 
-		return nil, false
+		dnsAddr = nil
+		for _, ns := range nsList {
+			r, _ := resolve(cfg.V.DNS.NameServerDefault, ns, dns.TypeA)
+			for _, ip := range r.addr {
+				dnsAddr = append(dnsAddr, net.JoinHostPort(ip.String(), "53"))
+			}
+		}
+
+		authNameServerLock.Lock()
+		authNameServer[zone] = dnsAddr
+		authNameServerLock.Unlock()
+
+		if len(dnsAddr) != 0 {
+			return dnsAddr
+		}
+	}
+
+	return nil
+}
+
+func parseAnswer(r *dns.Msg, host string, qtype uint16) (addr []net.IP, cname []string) {
+	target := make(map[string]string)
+	for _, ans := range r.Answer {
+		if v, ok := ans.(*dns.CNAME); ok {
+			target[strings.ToLower(v.Hdr.Name)] = v.Target
+		}
+	}
+
+	names := map[string]struct{}{
+		strings.ToLower(host): {},
+	}
+	for name := host; len(cname) < maxCnameDepth; {
+		next, ok := target[strings.ToLower(name)]
+		if !ok {
+			break
+		}
+		cname = append(cname, next)
+		names[strings.ToLower(next)] = struct{}{}
+		name = next
+	}
+
+	for _, ans := range r.Answer {
+		if _, ok := names[strings.ToLower(ans.Header().Name)]; !ok {
+			continue
+		}
+
+		switch v := ans.(type) {
+		case *dns.A:
+			if qtype == dns.TypeA {
+				addr = append(addr, v.A)
+			}
+		case *dns.AAAA:
+			if qtype == dns.TypeAAAA {
+				addr = append(addr, v.AAAA)
+			}
+		}
 	}
 
-	for i, addr := range dnsAddr {
-		if _, _, err := net.SplitHostPort(addr); err != nil {
-			dnsAddr[i] = addr + ":53"
+	return
+}
+
+// nameserver : ip[:port], tls://host[:port], https://host/dns-query
+func exchange(dnsAddr []string, msg *dns.Msg) *dns.Msg {
+	rt := func(r *dns.Msg) *dns.Msg {
+		if r == nil || r.Rcode != dns.RcodeSuccess {
+			return nil
 		}
+		return r
 	}
 
 	if len(dnsAddr) == 1 {
-		r, _, err := dnsClient.Exchange(&msg, dnsAddr[0])
+		r, err := exchangeOne(msg, dnsAddr[0])
 		if err != nil {
 			sentry.CaptureException(err)
-			return nil, false
+			return nil
 		}
 		return rt(r)
 	}
@@ -69,7 +227,7 @@ func resolve(dnsAddr []string, host string) (ip net.IP, ok bool) {
 
 		go func(nameserver string) {
 			defer wg.Done()
-			r, _, err := dnsClient.Exchange(&msg, nameserver)
+			r, err := exchangeOne(msg, nameserver)
 			if err != nil {
 				sentry.CaptureException(err)
 				return
@@ -100,5 +258,97 @@ func resolve(dnsAddr []string, host string) (ip net.IP, ok bool) {
 	default:
 	}
 
-	return nil, false
+	return nil
+}
+
+func newDnsClient(network string) *dns.Client {
+	return &dns.Client{
+		Net:          network,
+		Timeout:      cfg.V.DNS.Client.Timeout.Timeout,
+		ReadTimeout:  cfg.V.DNS.Client.Timeout.ReadTimeout,
+		WriteTimeout: cfg.V.DNS.Client.Timeout.WriteTimeout,
+		DialTimeout:  cfg.V.DNS.Client.Timeout.DialTimeout,
+	}
+}
+
+func exchangeOne(msg *dns.Msg, nameserver string) (*dns.Msg, error) {
+	switch {
+	case strings.HasPrefix(nameserver, "https://"):
+		return exchangeHTTPS(msg, nameserver)
+
+	case strings.HasPrefix(nameserver, "tls://"):
+		addr := strings.TrimPrefix(nameserver, "tls://")
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			host, port = addr, "853"
+		}
+
+		dnsClient := newDnsClient("tcp-tls")
+		dnsClient.TLSConfig = &tls.Config{
+			ServerName: host,
+			MinVersion: tls.VersionTLS12,
+		}
+
+		r, _, err := dnsClient.Exchange(msg, net.JoinHostPort(host, port))
+		return r, err
+
+	default:
+		if _, _, err := net.SplitHostPort(nameserver); err != nil {
+			nameserver = net.JoinHostPort(nameserver, "53")
+		}
+
+		dnsClient := newDnsClient("udp")
+
+		r, _, err := dnsClient.Exchange(msg, nameserver)
+		if err == nil && r != nil && r.Truncated {
+			dnsClient.Net = "tcp"
+			r, _, err = dnsClient.Exchange(msg, nameserver)
+		}
+		return r, err
+	}
+}
+
+// RFC 8484
+func exchangeHTTPS(msg *dns.Msg, uri string) (*dns.Msg, error) {
+	m := msg.Copy()
+	m.Id = 0
+
+	b, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.V.DNS.Client.Timeout.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s : %s", uri, res.Status)
+	}
+
+	b, err = ioutil.ReadAll(io.LimitReader(res.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(dns.Msg)
+	err = r.Unpack(b)
+	if err != nil {
+		return nil, err
+	}
+	r.Id = msg.Id
+
+	return r, nil
 }
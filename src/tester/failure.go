@@ -0,0 +1,132 @@
+package tester
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"twimgdns/src/common"
+
+	"github.com/pkg/errors"
+)
+
+// 동시 검사 중에도 실패가 기록될 수 있다
+var failureLock sync.Mutex
+
+// 반복 측정에서 같은 실패가 여러번 나와도 한번만 기록한다
+func (data *cdnTestHostDataResult) fail(kind string, detail string) {
+	f := common.ResultFailure{Kind: kind, Detail: detail}
+
+	failureLock.Lock()
+	defer failureLock.Unlock()
+
+	for _, v := range data.failure {
+		if v == f {
+			return
+		}
+	}
+	data.failure = append(data.failure, f)
+}
+
+func (data *cdnTestHostDataResult) failErr(err error) {
+	data.fail(failureKind(err), err.Error())
+}
+
+// 네트워크 오류를 실패 사유로 분류한다
+func failureKind(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, http.ErrHandlerTimeout),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return common.FailureTimeout
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return common.FailureTruncated
+
+	case isTLSError(err):
+		return common.FailureTLS
+	}
+
+	return common.FailureHTTP
+}
+
+func isTLSError(err error) bool {
+	var (
+		recordHeaderErr tls.RecordHeaderError
+		unknownAuthErr  x509.UnknownAuthorityError
+		hostnameErr     x509.HostnameError
+		certInvalidErr  x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordHeaderErr) || errors.As(err, &unknownAuthErr) || errors.As(err, &hostnameErr) || errors.As(err, &certInvalidErr) {
+		return true
+	}
+
+	// 핸드셰이크 중에 받은 alert 등은 타입이 공개되어있지 않다
+	s := err.Error()
+	return strings.Contains(s, "tls: ") || strings.Contains(s, "x509: ")
+}
+
+func pingFailureKind(mode string) string {
+	if mode == pingModeTcp {
+		return common.FailureTcpLoss
+	}
+	return common.FailureIcmpLoss
+}
+
+// 실패 사유별 후보 수. 한 후보에 같은 사유가 여러번 있어도 한번만 센다.
+func (td *cdnTestHostData) failureCount() map[string]int {
+	m := make(map[string]int)
+	if td.dnsFailure > 0 {
+		m[common.FailureDNS] = int(td.dnsFailure)
+	}
+
+	count := func(data *cdnTestHostDataResult) {
+		seen := make(map[string]struct{}, len(data.failure))
+		for _, f := range data.failure {
+			if _, ok := seen[f.Kind]; !ok {
+				seen[f.Kind] = struct{}{}
+				m[f.Kind]++
+			}
+		}
+	}
+	for _, data := range td.cdnAddrList {
+		count(data)
+	}
+	for _, data := range td.eliminated {
+		count(data)
+	}
+
+	return m
+}
+
+func (td *cdnTestHostData) logFailure() {
+	m := td.result.FailureCount
+	if len(m) == 0 {
+		return
+	}
+
+	kinds := make([]string, 0, len(m))
+	for kind := range m {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var sb strings.Builder
+	for i, kind := range kinds {
+		if i > 0 {
+			sb.WriteString(" / ")
+		}
+		fmt.Fprintf(&sb, "%s : %d", kind, m[kind])
+	}
+
+	log.Printf("[%s] Failure : %s (eliminated %d)\n", td.host, sb.String(), len(td.eliminated))
+}
@@ -0,0 +1,168 @@
+package tester
+
+import (
+	"io"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+
+	"github.com/getsentry/sentry-go"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const sourceHistory = "history"
+
+// 이전 검사에서 본 후보 IP. candidateHistory[Host][Addr]
+type candidateHistory map[string]map[string]*candidateHistoryEntry
+
+type candidateHistoryEntry struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"` // history 가 아닌 곳에서 마지막으로 수집된 시각
+	LastTest  time.Time `json:"last_test"`
+
+	Ping  time.Duration `json:"ping"`
+	Speed float64       `json:"speed"`
+	Score float64       `json:"score"` // 임계값에 걸렸으면 0
+
+	Published bool `json:"published"`
+
+	Tamper *common.ResultTamper `json:"tamper,omitempty"` // 격리 정보
+}
+
+func loadCandidateHistory() candidateHistory {
+	h := make(candidateHistory)
+
+	fs, err := os.Open(cfg.V.Path.History)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			sentry.CaptureException(err)
+		}
+		return h
+	}
+	defer fs.Close()
+
+	err = jsoniter.NewDecoder(fs).Decode(&h)
+	if err != nil {
+		sentry.CaptureException(err)
+		return make(candidateHistory)
+	}
+
+	return h
+}
+
+func (h candidateHistory) save() {
+	err := common.WriteFileAtomic(cfg.V.Path.History, 0600, func(w io.Writer) error {
+		return jsoniter.NewEncoder(w).Encode(h)
+	})
+	if err != nil {
+		sentry.CaptureException(err)
+	}
+}
+
+// 배포 중인 IP 와 이전 점수가 좋았던 IP 를 후보에 다시 넣는다
+func (h candidateHistory) inject(td *cdnTestHostData) {
+	type entry struct {
+		ip    net.IP
+		score float64
+	}
+	var top, topV6 []entry
+
+	for addr, e := range h[td.host] {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+
+		if e.Published {
+			td.addCandidate(ip, cdnTestHostDataResult{source: sourceHistory})
+			continue
+		}
+
+		if e.Score > 0 {
+			if ip.To4() == nil {
+				topV6 = append(topV6, entry{ip, e.Score})
+			} else {
+				top = append(top, entry{ip, e.Score})
+			}
+		}
+	}
+
+	for _, l := range [][]entry{top, topV6} {
+		sort.Slice(l, func(i, k int) bool { return l[i].score > l[k].score })
+
+		for i := 0; i < len(l) && i < cfg.V.Test.History.Top; i++ {
+			td.addCandidate(l[i].ip, cdnTestHostDataResult{source: sourceHistory})
+		}
+	}
+}
+
+// 검사 전에 호출. 수집된 후보를 모두 기록한다.
+func (h candidateHistory) seen(td *cdnTestHostData, now time.Time) {
+	entries, ok := h[td.host]
+	if !ok {
+		entries = make(map[string]*candidateHistoryEntry)
+		h[td.host] = entries
+	}
+
+	for _, data := range td.cdnAddrList {
+		e, ok := entries[data.addr]
+		if !ok {
+			e = &candidateHistoryEntry{
+				FirstSeen: now,
+				LastSeen:  now,
+			}
+			entries[data.addr] = e
+		}
+
+		if data.source != sourceHistory {
+			e.LastSeen = now
+		}
+
+		// 검사에서 떨어지면 0 으로 남는다
+		e.LastTest = now
+		e.Ping = 0
+		e.Speed = 0
+		e.Score = 0
+	}
+}
+
+// 검사 후에 호출. 성적과 배포한 IP 를 기록하고 오래된 IP 는 지운다.
+func (h candidateHistory) update(td *cdnTestHostData, now time.Time) {
+	entries := h[td.host]
+
+	for _, data := range td.cdnAddrList {
+		if e, ok := entries[data.addr]; ok {
+			e.Ping = data.pingAve
+			e.Speed = data.httpAve
+			e.Score = data.score.Score
+		}
+	}
+
+	for _, t := range td.tamper {
+		if e, ok := entries[t.Addr]; ok && !t.Until.IsZero() {
+			t := t
+			e.Tamper = &t
+		}
+	}
+
+	minDate := now.Add(cfg.V.Test.History.Expire * -1)
+
+	for addr, e := range entries {
+		e.Published = addr == td.result.Best.Addr || addr == td.result.BestV6.Addr
+
+		quarantined := e.Tamper != nil && now.Before(e.Tamper.Until)
+		if e.Tamper != nil && !quarantined {
+			common.Verbose.Printf("[%s] quarantine released : %s\n", td.host, addr)
+			e.Tamper = nil
+		}
+
+		if !e.Published && !quarantined && cfg.V.Test.History.Expire > 0 && e.LastSeen.Before(minDate) {
+			common.Verbose.Printf("[%s] history expired : %s\n", td.host, addr)
+			delete(entries, addr)
+		}
+	}
+}
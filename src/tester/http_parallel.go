@@ -0,0 +1,50 @@
+package tester
+
+import (
+	"sync"
+	"time"
+
+	"twimgdns/src/common"
+)
+
+// n 개의 스트림을 동시에 돌린다. sequential 은 같은 후보의 순차 검사 속도
+func parallelTest(n int, sequential float64, tf func(stream int) (common.ResultHttpProtocol, uint64)) *common.ResultHttpParallel {
+	r := &common.ResultHttpParallel{
+		Streams: n,
+		Stream:  make([]float64, n),
+	}
+
+	var w sync.WaitGroup
+	downloaded := make([]uint64, n)
+
+	startTime := time.Now()
+	for i := 0; i < n; i++ {
+		w.Add(1)
+		go func(i int) {
+			defer w.Done()
+
+			res, bytes := tf(i + 1)
+			if res.Speed != 0 {
+				r.Stream[i] = res.Speed
+				downloaded[i] = bytes
+			}
+		}(i)
+	}
+	w.Wait()
+	elapsed := time.Since(startTime)
+
+	var sum uint64
+	for i, v := range downloaded {
+		sum += v
+		if r.Stream[i] == 0 {
+			r.Failed++
+		}
+	}
+
+	r.Speed = float64(sum) / elapsed.Seconds()
+	if sequential > 0 {
+		r.Scaling = r.Speed / sequential
+	}
+
+	return r
+}
@@ -0,0 +1,176 @@
+package tester
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+
+	"twimgdns/src/common/cfg"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+const (
+	httpProtoH1  = "h1"
+	httpProtoH2  = "h2"
+	httpProtoH3  = "h3"
+	httpProtoAll = "all"
+)
+
+func checkHttpProtocol() {
+	for host, proto := range cfg.V.Test.Protocol {
+		switch proto {
+		case httpProtoH1, httpProtoH2, httpProtoH3, httpProtoAll:
+		default:
+			panic(fmt.Sprintf("unknown http protocol : %s (%s)", proto, host))
+		}
+	}
+}
+
+// 첫번째 프로토콜의 결과로 순위를 매긴다.
+// all 이면 브라우저가 처음 연결할 때 쓰는 h2 가 기준.
+func httpProtocols(host string) []string {
+	switch cfg.V.Test.Protocol[host] {
+	case httpProtoH2:
+		return []string{httpProtoH2}
+	case httpProtoH3:
+		return []string{httpProtoH3}
+	case httpProtoAll:
+		return []string{httpProtoH2, httpProtoH3, httpProtoH1}
+	default:
+		return []string{httpProtoH1}
+	}
+}
+
+// 호스트 이름은 그대로 두고 연결만 후보 IP 로 하는 클라이언트
+type speedTestClient struct {
+	client *http.Client
+	addr   string // 지금 검사 중인 후보
+
+	closeIdle func()
+}
+
+func newSpeedTestClient(proto string) *speedTestClient {
+	c := &speedTestClient{}
+
+	if proto == httpProtoH3 {
+		tr := &http3.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion: tls.VersionTLS13,
+			},
+			Dial: c.dialQUIC,
+		}
+		c.client = &http.Client{
+			Timeout:   cfg.V.HTTP.Client.Timeout.Timeout,
+			Transport: tr,
+		}
+		c.closeIdle = tr.CloseIdleConnections
+		return c
+	}
+
+	c.client = newHttpClient()
+	tr := c.client.Transport.(*http.Transport)
+	if proto == httpProtoH2 {
+		tr.ForceAttemptHTTP2 = true
+	} else {
+		tr.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+	tr.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return c.dialTLS(ctx, tr, network, addr)
+	}
+	c.closeIdle = tr.CloseIdleConnections
+
+	return c
+}
+
+// 이전 후보에 연결된 것을 재사용하지 않도록
+func (c *speedTestClient) target(addr string) {
+	c.closeIdle()
+	c.addr = addr
+}
+
+func (c *speedTestClient) dialTLS(ctx context.Context, tr *http.Transport, network, addr string) (net.Conn, error) {
+	host, port, _ := net.SplitHostPort(addr)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(c.addr, port))
+	if err != nil {
+		return nil, err
+	}
+
+	// ForceAttemptHTTP2 이면 http.Transport 가 NextProtos 에 h2 를 넣어둔다
+	tconfig := tr.TLSClientConfig.Clone()
+	tconfig.ServerName = host
+
+	tc := tls.Client(conn, tconfig)
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+
+	errChannel := make(chan error, 1)
+	go func() {
+		errChannel <- tc.Handshake()
+	}()
+	select {
+	case <-ctx.Done():
+		tc.Close()
+		return nil, http.ErrHandlerTimeout
+	case err = <-errChannel:
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(tc.ConnectionState(), nil)
+	}
+
+	go func() {
+		errChannel <- tc.VerifyHostname(host)
+	}()
+	select {
+	case <-ctx.Done():
+		tc.Close()
+		return nil, http.ErrHandlerTimeout
+	case err = <-errChannel:
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tc, nil
+}
+
+// QUIC 는 연결과 TLS 핸드셰이크가 같이 끝나므로 두 구간을 같은 값으로 기록한다
+func (c *speedTestClient) dialQUIC(ctx context.Context, addr string, tlsCfg *tls.Config, qcfg *quic.Config) (*quic.Conn, error) {
+	_, port, _ := net.SplitHostPort(addr)
+	addr = net.JoinHostPort(c.addr, port)
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.ConnectStart != nil {
+		trace.ConnectStart("udp", addr)
+	}
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+
+	conn, err := quic.DialAddr(ctx, addr, tlsCfg, qcfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if trace != nil && trace.ConnectDone != nil {
+		trace.ConnectDone("udp", addr, nil)
+	}
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(conn.ConnectionState().TLS, nil)
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,95 @@
+package tester
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+)
+
+// 속도 검사 요청 하나. size 가 0 이면 파일 전체
+type testData struct {
+	url  string
+	hash []byte
+
+	offset int64
+	size   int64
+}
+
+func (d testData) status() int {
+	if d.size > 0 {
+		return http.StatusPartialContent
+	}
+	return http.StatusOK
+}
+
+func (d testData) String() string {
+	if d.size > 0 {
+		return fmt.Sprintf("%s (%d-%d)", d.url, d.offset, d.offset+d.size-1)
+	}
+	return d.url
+}
+
+// 조각 크기별로 cfg.V.Test.Range.Count 개씩 고른다. range 방식을 쓰지 않으면 nil
+func (td *cdnTestHostData) rangePlan() []testData {
+	chunks := cfg.RangeFile[td.host]
+	if !cfg.V.Test.Range.Enable || len(chunks) == 0 {
+		return nil
+	}
+
+	bySize := make(map[int64][]cfg.RangeChunk)
+	for _, c := range chunks {
+		bySize[c.Size] = append(bySize[c.Size], c)
+	}
+
+	count := cfg.V.Test.Range.Count
+	if count <= 0 {
+		count = 1
+	}
+
+	plan := make([]testData, 0, len(bySize)*count)
+	for _, l := range bySize {
+		for n, i := range rand.Perm(len(l)) {
+			if n == count {
+				break
+			}
+			plan = append(
+				plan,
+				testData{
+					url:    l[i].URL,
+					hash:   l[i].Hash,
+					offset: l[i].Offset,
+					size:   l[i].Size,
+				},
+			)
+		}
+	}
+
+	// 크기별로 몰려서 받지 않도록 섞는다
+	rand.Shuffle(len(plan), func(i, k int) { plan[i], plan[k] = plan[k], plan[i] })
+
+	return plan
+}
+
+func newRangeStat(m map[int64][]float64) []common.ResultHttpRange {
+	if len(m) == 0 {
+		return nil
+	}
+
+	l := make([]common.ResultHttpRange, 0, len(m))
+	for size, speed := range m {
+		l = append(
+			l,
+			common.ResultHttpRange{
+				Size:  size,
+				Speed: newSampleStat(speed),
+			},
+		)
+	}
+	sort.Slice(l, func(i, k int) bool { return l[i].Size < l[k].Size })
+
+	return l
+}
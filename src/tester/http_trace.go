@@ -0,0 +1,113 @@
+package tester
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"strings"
+	"time"
+
+	"twimgdns/src/common"
+)
+
+// 요청 하나의 단계별 시각
+type httpTrace struct {
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteHeaders time.Time // http3 는 WroteRequest 를 부르지 않는다
+	wroteRequest time.Time
+	firstByte    time.Time
+	done         time.Time
+}
+
+// DialTLSContext 에서 직접 핸드셰이크를 하고 나면 http.Transport 가 한번 더 TLSHandshakeStart/Done 을 부르므로 처음 값만 남긴다
+func (t *httpTrace) clientTrace() *httptrace.ClientTrace {
+	set := func(p *time.Time) {
+		if p.IsZero() {
+			*p = time.Now()
+		}
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { set(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { set(&t.dnsDone) },
+		ConnectStart:         func(string, string) { set(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { set(&t.connectDone) },
+		TLSHandshakeStart:    func() { set(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { set(&t.tlsDone) },
+		WroteHeaders:         func() { set(&t.wroteHeaders) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&t.wroteRequest) },
+		GotFirstResponseByte: func() { set(&t.firstByte) },
+	}
+}
+
+func (t *httpTrace) timing() common.ResultHttpTiming {
+	since := func(start, end time.Time) time.Duration {
+		if start.IsZero() || end.IsZero() {
+			return 0
+		}
+		return end.Sub(start)
+	}
+
+	wrote := t.wroteRequest
+	if wrote.IsZero() {
+		wrote = t.wroteHeaders
+	}
+
+	r := common.ResultHttpTiming{
+		Sample:   1,
+		DNS:      since(t.dnsStart, t.dnsDone),
+		Connect:  since(t.connectStart, t.connectDone),
+		TLS:      since(t.tlsStart, t.tlsDone),
+		TTFB:     since(wrote, t.firstByte),
+		Transfer: since(t.firstByte, t.done),
+	}
+	if !t.connectStart.IsZero() {
+		r.NewConn = 1
+	}
+
+	return r
+}
+
+// 연결 시간과 TLS 시간은 새로 연결한 요청끼리, 나머지는 전체 요청의 평균
+func averageHttpTiming(l []common.ResultHttpTiming) (r common.ResultHttpTiming) {
+	var proto []string
+	for _, t := range l {
+		found := false
+		for _, p := range proto {
+			if p == t.Proto {
+				found = true
+				break
+			}
+		}
+		if !found && t.Proto != "" {
+			proto = append(proto, t.Proto)
+		}
+
+		r.Sample += t.Sample
+		r.NewConn += t.NewConn
+
+		r.DNS += t.DNS
+		r.Connect += t.Connect
+		r.TLS += t.TLS
+		r.TTFB += t.TTFB
+		r.Transfer += t.Transfer
+	}
+
+	r.Proto = strings.Join(proto, ",")
+
+	if r.NewConn > 0 {
+		r.DNS /= time.Duration(r.NewConn)
+		r.Connect /= time.Duration(r.NewConn)
+		r.TLS /= time.Duration(r.NewConn)
+	}
+	if r.Sample > 0 {
+		r.TTFB /= time.Duration(r.Sample)
+		r.Transfer /= time.Duration(r.Sample)
+	}
+
+	return
+}
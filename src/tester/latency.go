@@ -0,0 +1,224 @@
+package tester
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+
+	"github.com/asmpro/go-ping"
+)
+
+const (
+	pingModeIcmp             = "icmp"              // raw socket. root 나 CAP_NET_RAW 필요
+	pingModeIcmpUnprivileged = "icmp_unprivileged" // datagram socket. net.ipv4.ping_group_range 필요
+	pingModeTcp              = "tcp"               // 443 포트 TCP 연결 시간
+)
+
+func checkPingMode() {
+	for _, mode := range cfg.V.Test.PingMode {
+		switch mode {
+		case pingModeIcmp, pingModeIcmpUnprivileged, pingModeTcp:
+		default:
+			panic(fmt.Sprintf("unknown ping mode : %s", mode))
+		}
+	}
+}
+
+func checkLoadedPing() {
+	if cfg.V.Test.LoadedPing.Enable && cfg.V.Test.LoadedPing.Interval <= 0 {
+		panic("loaded_ping.interval must be > 0")
+	}
+}
+
+// 설정이 없으면 go-ping 의 기본값과 같은 1초
+func pingInterval() time.Duration {
+	if cfg.V.Test.PingInterval <= 0 {
+		return time.Second
+	}
+	return cfg.V.Test.PingInterval
+}
+
+func pingModes() []string {
+	if len(cfg.V.Test.PingMode) == 0 {
+		return []string{pingModeIcmp}
+	}
+	return cfg.V.Test.PingMode
+}
+
+func probeLatency(mode string, addr string) common.ResultPingStat {
+	switch mode {
+	case pingModeTcp:
+		return tcpPing(addr)
+	default:
+		return icmpPing(mode, addr)
+	}
+}
+
+func icmpPing(mode string, addr string) common.ResultPingStat {
+	pinger, err := ping.NewPinger(addr)
+	if err != nil {
+		return common.ResultPingStat{Mode: mode}
+	}
+	pinger.Count = cfg.V.Test.PingCount
+	pinger.Interval = pingInterval()
+	pinger.Timeout = cfg.V.Test.PingTimeout
+
+	pinger.SetPrivileged(mode == pingModeIcmp)
+	pinger.Run()
+
+	stats := pinger.Statistics()
+	return newPingStat(mode, stats.PacketsSent, stats.Rtts)
+}
+
+func tcpPing(addr string) common.ResultPingStat {
+	var sent int
+	var rtts []time.Duration
+
+	deadline := time.Now().Add(cfg.V.Test.PingTimeout)
+
+	for i := 0; i < cfg.V.Test.PingCount && time.Now().Before(deadline); i++ {
+		if i > 0 {
+			time.Sleep(pingInterval())
+		}
+
+		sent++
+
+		if rtt, ok := tcpProbe(addr, time.Until(deadline)); ok {
+			rtts = append(rtts, rtt)
+		}
+	}
+
+	return newPingStat(pingModeTcp, sent, rtts)
+}
+
+func tcpProbe(addr string, timeout time.Duration) (time.Duration, bool) {
+	startTime := time.Now()
+	c, err := net.DialTimeout("tcp", net.JoinHostPort(addr, "443"), timeout)
+	if err != nil {
+		return 0, false
+	}
+	rtt := time.Since(startTime)
+	c.Close()
+
+	return rtt, true
+}
+
+func icmpProbe(mode string, addr string, timeout time.Duration) (time.Duration, bool) {
+	pinger, err := ping.NewPinger(addr)
+	if err != nil {
+		return 0, false
+	}
+	pinger.Count = 1
+	pinger.Timeout = timeout
+
+	pinger.SetPrivileged(mode == pingModeIcmp)
+	pinger.Run()
+
+	stats := pinger.Statistics()
+	if len(stats.Rtts) == 0 {
+		return 0, false
+	}
+	return stats.Rtts[0], true
+}
+
+// 반환된 함수를 부를 때까지 cfg.V.Test.LoadedPing.Interval 마다 지연시간을 잰다
+func startLoadedPing(addr string) (stop func() common.ResultPingStat) {
+	mode := pingModes()[0]
+
+	done := make(chan struct{})
+	result := make(chan common.ResultPingStat, 1)
+
+	go func() {
+		var sent int
+		var rtts []time.Duration
+
+		ticker := time.NewTicker(cfg.V.Test.LoadedPing.Interval)
+		defer ticker.Stop()
+
+		for {
+			var rtt time.Duration
+			var ok bool
+			if mode == pingModeTcp {
+				rtt, ok = tcpProbe(addr, cfg.V.Test.LoadedPing.Timeout)
+			} else {
+				rtt, ok = icmpProbe(mode, addr, cfg.V.Test.LoadedPing.Timeout)
+			}
+
+			// 검사가 끝난 뒤에 받은 응답은 넣지 않는다
+			select {
+			case <-done:
+				result <- newPingStat(mode, sent, rtts)
+				return
+			default:
+			}
+
+			sent++
+			if ok {
+				rtts = append(rtts, rtt)
+			}
+
+			select {
+			case <-done:
+				result <- newPingStat(mode, sent, rtts)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() common.ResultPingStat {
+		close(done)
+		return <-result
+	}
+}
+
+func (data *cdnTestHostDataResult) setBufferbloat(loaded common.ResultPingStat) {
+	idle := data.primaryPing()
+	if idle.Recv == 0 || loaded.Recv == 0 {
+		return
+	}
+
+	data.bufferbloat = &common.ResultBufferbloat{
+		Mode:     loaded.Mode,
+		Idle:     idle.Stat.Median,
+		Loaded:   loaded,
+		Increase: loaded.Stat.Median - idle.Stat.Median,
+	}
+}
+
+func newPingStat(mode string, sent int, rtts []time.Duration) common.ResultPingStat {
+	stat := common.ResultPingStat{
+		Mode: mode,
+		Sent: sent,
+		Recv: len(rtts),
+		Stat: newDurationStat(rtts),
+	}
+	if len(rtts) == 0 {
+		return stat
+	}
+
+	var sum time.Duration
+	stat.Min = rtts[0]
+	for _, rtt := range rtts {
+		sum += rtt
+		if rtt < stat.Min {
+			stat.Min = rtt
+		}
+		if rtt > stat.Max {
+			stat.Max = rtt
+		}
+	}
+	stat.Avg = sum / time.Duration(len(rtts))
+
+	var sd float64
+	for _, rtt := range rtts {
+		sd += math.Pow(float64(rtt-stat.Avg), 2)
+	}
+	stat.StdDev = time.Duration(math.Sqrt(sd / float64(len(rtts))))
+
+	return stat
+}
@@ -10,6 +10,12 @@ import (
 var running int32
 
 func Main() {
+	candidateSources = newCandidateSources()
+	checkPingMode()
+	checkHttpProtocol()
+	checkLoadedPing()
+	checkCurve()
+
 	ticker := time.NewTicker(cfg.V.Test.RefreshInterval)
 
 	for {
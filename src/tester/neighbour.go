@@ -0,0 +1,92 @@
+package tester
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+)
+
+const sourceNeighbour = "neighbour"
+
+// 수집된 후보와 같은 대역의 주소에 TLS 연결을 시도해서, 인증서가 유효한 주소를 후보에 추가한다.
+func (td *cdnTestHostData) neighbourSweep() {
+	var seed []net.IP
+	for _, data := range td.cdnAddrList {
+		seed = append(seed, net.ParseIP(data.addr))
+	}
+
+	// rate 가 0 이하면 제한 없음
+	var tick <-chan time.Time
+	if cfg.V.Test.Neighbour.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(cfg.V.Test.Neighbour.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var w sync.WaitGroup
+	workers := tlsWorkers()
+	chAddr := make(chan net.IP, workers)
+
+	for i := 0; i < workers; i++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+
+			for ip := range chAddr {
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.V.Test.Neighbour.Timeout)
+				state, err := tlsProbe(ctx, ip.String(), td.host)
+				cancel()
+
+				if err == nil {
+					common.Verbose.Printf("[%s] neighbour %s\n", td.host, ip.String())
+
+					c := cdnTestHostDataResult{source: sourceNeighbour}
+					c.setCert(state)
+					td.addCandidate(ip, c)
+				}
+			}
+		}()
+	}
+
+	swept := make(map[string]struct{})
+	for _, ip := range seed {
+		prefix := cfg.V.Test.Neighbour.Prefix
+		if ip.To4() == nil {
+			prefix = cfg.V.Test.Neighbour.PrefixV6
+		} else {
+			ip = ip.To4()
+		}
+
+		ipNet := &net.IPNet{
+			IP:   ip.Mask(net.CIDRMask(prefix, len(ip)*8)),
+			Mask: net.CIDRMask(prefix, len(ip)*8),
+		}
+		if _, ok := swept[ipNet.String()]; ok {
+			continue
+		}
+		swept[ipNet.String()] = struct{}{}
+
+		common.Verbose.Printf("[%s] neighbour sweep %s\n", td.host, ipNet.String())
+
+		for cur := ipNet.IP; ipNet.Contains(cur); cur = nextIP(cur) {
+			td.cdnAddrListLock.Lock()
+			_, ok := td.cdnAddrList[ip2key(cur)]
+			td.cdnAddrListLock.Unlock()
+			if ok {
+				continue
+			}
+
+			if tick != nil {
+				<-tick
+			}
+			chAddr <- cur
+		}
+	}
+	close(chAddr)
+
+	w.Wait()
+}
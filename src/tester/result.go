@@ -0,0 +1,82 @@
+package tester
+
+import (
+	"sort"
+
+	"twimgdns/src/common"
+)
+
+func (td *cdnTestHostData) eliminate(k ipKey) {
+	td.eliminated = append(td.eliminated, td.cdnAddrList[k])
+	delete(td.cdnAddrList, k)
+}
+
+func (data *cdnTestHostDataResult) resultDataCdn() common.ResultDataCdn {
+	return common.ResultDataCdn{
+		Addr:     data.addr,
+		Ping:     data.pingAve,
+		Speed:    data.httpAve,
+		CName:    data.cname,
+		Provider: data.provider,
+
+		CertIssuer: data.certIssuer,
+		CertExpire: data.certExpire,
+
+		PingStat:   data.pingStat,
+		HttpStat:   data.httpStat,
+		HttpTiming: data.httpTiming,
+
+		Protocol: data.httpProtocol,
+		Range:    data.httpRange,
+		Parallel: data.httpParallel,
+
+		Bufferbloat: data.bufferbloat,
+		Curve:       data.curve,
+
+		Score: data.score,
+	}
+}
+
+// 점수 순으로 정렬한 전체 후보. 순위는 IPv4, IPv6 따로 매기고, 떨어진 후보는 순위 0 으로 뒤에 붙인다.
+func (td *cdnTestHostData) candidateList() []common.ResultCandidate {
+	l := make([]common.ResultCandidate, 0, len(td.cdnAddrList)+len(td.eliminated))
+
+	newCandidate := func(data *cdnTestHostDataResult) common.ResultCandidate {
+		return common.ResultCandidate{
+			ResultDataCdn: data.resultDataCdn(),
+			V6:            data.v6,
+			Default:       data.isDefault,
+			Source:        data.source,
+			Subnet:        data.subnet,
+			Failure:       data.failure,
+		}
+	}
+
+	for _, data := range td.cdnAddrList {
+		l = append(l, newCandidate(data))
+	}
+	sort.SliceStable(l, func(i, k int) bool {
+		return l[i].Score.Score > l[k].Score.Score
+	})
+
+	var rank, rankV6 int
+	for i := range l {
+		if l[i].Score.Reject != "" {
+			continue
+		}
+
+		if l[i].V6 {
+			rankV6++
+			l[i].Rank = rankV6
+		} else {
+			rank++
+			l[i].Rank = rank
+		}
+	}
+
+	for _, data := range td.eliminated {
+		l = append(l, newCandidate(data))
+	}
+
+	return l
+}
@@ -0,0 +1,157 @@
+package tester
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+
+	"github.com/dustin/go-humanize"
+)
+
+// 지연시간 계열 항목을 비교할 때 0 에 가까운 값 때문에 점수가 튀지 않도록 더하는 값 (ms)
+const scoreSmoothing = 1.0
+
+// 항목별 점수는 같은 호스트의 후보 중 가장 좋은 값 대비 비율 (0~1).
+// steady 만은 후보 자신의 지속 속도 / 순간 속도. 잴 수 없었으면 가중치에서 뺀다.
+// 총점은 가중 평균에 100 을 곱한 값이고, 임계값을 넘으면 0 점.
+func (td *cdnTestHostData) score() {
+	weight := cfg.V.Test.Score.Weight
+	if w, ok := cfg.V.Test.Score.HostWeight[td.host]; ok {
+		weight = w
+	}
+	weightSum := weight.Throughput + weight.Latency + weight.Jitter + weight.Loss + weight.TTFB + weight.Bufferbloat + weight.Steady
+	if weightSum <= 0 {
+		weight.Throughput = 1
+		weightSum = 1
+	}
+
+	var maxSpeed float64
+	minLatency, minJitter, minTtfb, minBloat := math.Inf(1), math.Inf(1), math.Inf(1), math.Inf(1)
+
+	for _, data := range td.cdnAddrList {
+		ping := data.primaryPing()
+
+		maxSpeed = math.Max(maxSpeed, data.httpStat.Median)
+		if ping.Recv > 0 {
+			minLatency = math.Min(minLatency, ping.Stat.Median)
+			minJitter = math.Min(minJitter, ping.Stat.Jitter)
+		}
+		if data.httpTiming.Sample > 0 {
+			minTtfb = math.Min(minTtfb, durationMs(data.httpTiming.TTFB))
+		}
+		if data.bufferbloat != nil {
+			minBloat = math.Min(minBloat, data.bloat())
+		}
+	}
+
+	lowerIsBetter := func(best, v float64) float64 {
+		if math.IsInf(best, 1) {
+			return 0
+		}
+		return (best + scoreSmoothing) / (v + scoreSmoothing)
+	}
+
+	for _, data := range td.cdnAddrList {
+		ping := data.primaryPing()
+
+		var s common.ResultScore
+		if maxSpeed > 0 {
+			s.Throughput = data.httpStat.Median / maxSpeed
+		}
+		if ping.Recv > 0 {
+			s.Latency = lowerIsBetter(minLatency, ping.Stat.Median)
+			s.Jitter = lowerIsBetter(minJitter, ping.Stat.Jitter)
+		}
+		s.Loss = 1 - data.pingLoss()
+		if data.httpTiming.Sample > 0 {
+			s.TTFB = lowerIsBetter(minTtfb, durationMs(data.httpTiming.TTFB))
+		}
+		if data.bufferbloat != nil {
+			s.Bufferbloat = lowerIsBetter(minBloat, data.bloat())
+		}
+		// 속도가 유지되는 비율. 중간에 빨라진 것은 1.
+		// 검사가 짧아서 알 수 없으면 steady 는 빼고 계산한다
+		sum := weightSum
+		if data.curve != nil && data.curve.Measured {
+			s.Steady = math.Min(1, data.curve.Ratio)
+		} else if sum -= weight.Steady; sum <= 0 {
+			s.Steady = 1
+			sum = weightSum
+		}
+
+		s.Score = 100 * (weight.Throughput*s.Throughput +
+			weight.Latency*s.Latency +
+			weight.Jitter*s.Jitter +
+			weight.Loss*s.Loss +
+			weight.TTFB*s.TTFB +
+			weight.Bufferbloat*s.Bufferbloat +
+			weight.Steady*s.Steady) / sum
+
+		if s.Reject = data.checkThreshold(); s.Reject != "" {
+			s.Score = 0
+			data.fail(common.FailureThreshold, s.Reject)
+		}
+
+		data.score = s
+		common.Verbose.Printf("[%s] score %15s : %6.2f %s\n", td.host, data.addr, s.Score, s.Reject)
+	}
+}
+
+func (data *cdnTestHostDataResult) primaryPing() common.ResultPingStat {
+	if len(data.pingStat) == 0 {
+		return common.ResultPingStat{}
+	}
+	return data.pingStat[0]
+}
+
+func (data *cdnTestHostDataResult) pingLoss() float64 {
+	ping := data.primaryPing()
+	if ping.Sent == 0 {
+		return 1
+	}
+	return 1 - float64(ping.Recv)/float64(ping.Sent)
+}
+
+// 임계값을 넘은 항목. 없으면 빈 문자열
+func (data *cdnTestHostDataResult) checkThreshold() string {
+	th := cfg.V.Test.Score.Threshold
+	ping := data.primaryPing()
+
+	switch {
+	// 지연시간 항목만으로 뽑히지 않도록
+	case data.httpAve <= 0:
+		return "no throughput"
+
+	case th.MinThroughput > 0 && data.httpStat.Median < float64(th.MinThroughput):
+		return fmt.Sprintf("throughput %s/s < %s/s", humanize.IBytes(uint64(data.httpStat.Median)), humanize.IBytes(th.MinThroughput))
+
+	case th.MaxLatency > 0 && ping.Recv > 0 && ping.Stat.Median > durationMs(th.MaxLatency):
+		return fmt.Sprintf("latency %.2f ms > %.2f ms", ping.Stat.Median, durationMs(th.MaxLatency))
+
+	case th.MaxJitter > 0 && ping.Recv > 0 && ping.Stat.Jitter > durationMs(th.MaxJitter):
+		return fmt.Sprintf("jitter %.2f ms > %.2f ms", ping.Stat.Jitter, durationMs(th.MaxJitter))
+
+	case th.MaxLoss > 0 && data.pingLoss() > th.MaxLoss:
+		return fmt.Sprintf("loss %.0f%% > %.0f%%", data.pingLoss()*100, th.MaxLoss*100)
+
+	case th.MaxTTFB > 0 && data.httpTiming.TTFB > th.MaxTTFB:
+		return fmt.Sprintf("ttfb %.2f ms > %.2f ms", durationMs(data.httpTiming.TTFB), durationMs(th.MaxTTFB))
+
+	case th.MaxBufferbloat > 0 && data.bufferbloat != nil && data.bloat() > durationMs(th.MaxBufferbloat):
+		return fmt.Sprintf("bufferbloat %.2f ms > %.2f ms", data.bloat(), durationMs(th.MaxBufferbloat))
+	}
+
+	return ""
+}
+
+// 부하 중에 늘어난 지연시간 (ms). 줄어든 것은 0 으로 본다
+func (data *cdnTestHostDataResult) bloat() float64 {
+	return math.Max(0, data.bufferbloat.Increase)
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,75 @@
+package tester
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"twimgdns/src/common"
+)
+
+// 95% 신뢰구간
+const ciZ = 1.96
+
+func newSampleStat(v []float64) (r common.ResultStat) {
+	r.Count = len(v)
+	if r.Count == 0 {
+		return
+	}
+
+	sorted := make([]float64, len(v))
+	copy(sorted, v)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, x := range v {
+		sum += x
+	}
+	r.Mean = sum / float64(r.Count)
+
+	r.Min = sorted[0]
+	r.Max = sorted[len(sorted)-1]
+	r.Median = percentile(sorted, 50)
+	r.P90 = percentile(sorted, 90)
+	r.P95 = percentile(sorted, 95)
+
+	if r.Count > 1 {
+		var sd, jitter float64
+		for i, x := range v {
+			sd += (x - r.Mean) * (x - r.Mean)
+			if i > 0 {
+				jitter += math.Abs(x - v[i-1])
+			}
+		}
+		r.StdDev = math.Sqrt(sd / float64(r.Count-1))
+		r.Jitter = jitter / float64(r.Count-1)
+	}
+
+	ci := ciZ * r.StdDev / math.Sqrt(float64(r.Count))
+	r.CILow = r.Mean - ci
+	r.CIHigh = r.Mean + ci
+
+	return
+}
+
+// 밀리초 단위
+func newDurationStat(v []time.Duration) common.ResultStat {
+	l := make([]float64, len(v))
+	for i, d := range v {
+		l[i] = float64(d) / float64(time.Millisecond)
+	}
+	return newSampleStat(l)
+}
+
+// sorted 는 정렬되어 있어야 한다. 선형 보간.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
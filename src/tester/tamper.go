@@ -0,0 +1,139 @@
+package tester
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+
+	"github.com/getsentry/sentry-go"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// 검사 파일의 해시가 다르면 CDN 이나 경로 중간에서 내용을 바꾼 것으로 본다
+func (td *cdnTestHostData) reportTamper(data *cdnTestHostDataResult, url string, expected, actual []byte) {
+	data.fail(common.FailureHashMismatch, url)
+
+	failureLock.Lock()
+	data.tampered = true
+	failureLock.Unlock()
+
+	t := common.ResultTamper{
+		Host:       td.host,
+		Addr:       data.addr,
+		URL:        url,
+		Expected:   hex.EncodeToString(expected),
+		Actual:     hex.EncodeToString(actual),
+		DetectedAt: time.Now(),
+		New:        true,
+	}
+	if cfg.V.Test.Tamper.Quarantine > 0 {
+		t.Until = t.DetectedAt.Add(cfg.V.Test.Tamper.Quarantine)
+	}
+
+	log.Printf("[%s] TAMPER %15s : %s (expected %s, actual %s)\n", td.host, data.addr, url, t.Expected, t.Actual)
+	sentry.CaptureMessage(fmt.Sprintf("tamper : %s %s %s", td.host, data.addr, url))
+
+	td.tamperLock.Lock()
+	td.tamper = append(td.tamper, t)
+	td.tamperLock.Unlock()
+}
+
+// 격리 중인 IP 는 검사하지 않는다
+func (td *cdnTestHostData) quarantineFilter(now time.Time) {
+	entries := td.p.history[td.host]
+
+	for k, data := range td.cdnAddrList {
+		e, ok := entries[data.addr]
+		if !ok || e.Tamper == nil || !now.Before(e.Tamper.Until) {
+			continue
+		}
+
+		common.Verbose.Printf("[%s] quarantine %15s : until %s\n", td.host, data.addr, e.Tamper.Until)
+		data.fail(common.FailureQuarantine, fmt.Sprintf("%s until %s", e.Tamper.URL, e.Tamper.Until.Format(time.RFC3339)))
+		td.eliminate(k)
+	}
+}
+
+// 이번에 발견한 것과 아직 격리 중인 것
+func (td *cdnTestHostData) tamperList(now time.Time) []common.ResultTamper {
+	l := make([]common.ResultTamper, 0, len(td.tamper))
+	l = append(l, td.tamper...)
+
+	for addr, e := range td.p.history[td.host] {
+		if e.Tamper == nil || !now.Before(e.Tamper.Until) {
+			continue
+		}
+
+		found := false
+		for _, t := range td.tamper {
+			if t.Addr == addr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t := *e.Tamper
+			t.New = false
+			l = append(l, t)
+		}
+	}
+
+	sort.Slice(l, func(i, k int) bool { return l[i].Addr < l[k].Addr })
+	return l
+}
+
+func sendTamperWebhook(l []common.ResultTamper) {
+	if cfg.V.Test.Tamper.Webhook.URL == "" || len(l) == 0 {
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "content tampering detected (%d)", len(l))
+	for _, t := range l {
+		fmt.Fprintf(&sb, "\n%s %s %s", t.Host, t.Addr, t.URL)
+	}
+
+	body := struct {
+		Text   string                `json:"text"`
+		Tamper []common.ResultTamper `json:"tamper"`
+	}{
+		Text:   sb.String(),
+		Tamper: l,
+	}
+
+	var buf bytes.Buffer
+	err := jsoniter.NewEncoder(&buf).Encode(&body)
+	if err != nil {
+		sentry.CaptureException(err)
+		return
+	}
+
+	req, err := http.NewRequest("POST", cfg.V.Test.Tamper.Webhook.URL, &buf)
+	if err != nil {
+		sentry.CaptureException(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range cfg.V.Test.Tamper.Webhook.Header {
+		req.Header.Set(k, v)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		sentry.CaptureException(err)
+		return
+	}
+	res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		sentry.CaptureMessage(fmt.Sprintf("tamper webhook : %s", res.Status))
+	}
+}
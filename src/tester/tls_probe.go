@@ -0,0 +1,110 @@
+package tester
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"twimgdns/src/common"
+	"twimgdns/src/common/cfg"
+)
+
+// addr 의 443 포트에 host 를 SNI 로 TLS 연결을 맺고, 인증서가 host 에 유효한지 확인한다.
+func tlsProbe(ctx context.Context, addr string, host string) (state tls.ConnectionState, err error) {
+	var dialer net.Dialer
+	c, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr, "443"))
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+
+	tc := tls.Client(
+		c,
+		&tls.Config{
+			ServerName: host,
+			MinVersion: tls.VersionTLS12,
+		},
+	)
+
+	err = tc.Handshake()
+	if err != nil {
+		return
+	}
+
+	err = tc.VerifyHostname(host)
+	if err != nil {
+		return
+	}
+
+	return tc.ConnectionState(), nil
+}
+
+// 설정이 없으면 핑과 같은 수. 0 이면 보낼 곳이 없어 멈춘다
+func tlsWorkers() int {
+	if cfg.V.Test.Worker.Tls <= 0 {
+		return cfg.V.Test.Worker.Ping
+	}
+	return cfg.V.Test.Worker.Tls
+}
+
+// 핑이나 HTTP 검사 전에 TLS 연결이 되지 않는 후보를 걸러낸다
+func (td *cdnTestHostData) tlsFilter() {
+	var w sync.WaitGroup
+	workers := tlsWorkers()
+	chCdnData := make(chan *cdnTestHostDataResult, workers)
+
+	for i := 0; i < workers; i++ {
+		w.Add(1)
+		go func() {
+			defer w.Done()
+
+			for cdnData := range chCdnData {
+				ctx, cancel := context.WithTimeout(context.Background(), cfg.V.Test.TlsTimeout)
+				state, err := tlsProbe(ctx, cdnData.addr, td.host)
+				cancel()
+
+				if err != nil {
+					common.Verbose.Printf("[%s] tls  %15s : %v\n", td.host, cdnData.addr, err)
+					if kind := failureKind(err); kind == common.FailureTimeout {
+						cdnData.fail(kind, err.Error())
+					} else {
+						cdnData.fail(common.FailureTLS, err.Error())
+					}
+					continue
+				}
+
+				cdnData.setCert(state)
+			}
+		}()
+	}
+
+	for _, d := range td.cdnAddrList {
+		if !d.tlsChecked {
+			chCdnData <- d
+		}
+	}
+	close(chCdnData)
+
+	w.Wait()
+
+	for k, data := range td.cdnAddrList {
+		if !data.isDefault && !data.tlsChecked {
+			td.eliminate(k)
+		}
+	}
+}
+
+func (cdnData *cdnTestHostDataResult) setCert(state tls.ConnectionState) {
+	cdnData.tlsChecked = true
+
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		cdnData.certIssuer = cert.Issuer.CommonName
+		cdnData.certExpire = cert.NotAfter
+	}
+}